@@ -0,0 +1,140 @@
+package convert
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	goutilerrors "github.com/spudtrooper/goutil/errors"
+	"github.com/spudtrooper/goutil/or"
+)
+
+// stdinInputs as the input reads the names of the inputs from stdin.
+const stdinInputs = "-"
+
+// imageExts are the extensions of the files taken from directories.
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// ExpandInputs returns the files named by input: every image in it if it's a
+// directory, the matches if it's a glob like "data/in/*.png" and no file of
+// that name exists, the lines read from stdin if it's "-", or else input
+// itself. A directory without images or a glob without matches is an error.
+func ExpandInputs(input string, stdin io.Reader) ([]string, error) {
+	if input == stdinInputs {
+		var res []string
+		scanner := bufio.NewScanner(stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				res = append(res, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Errorf("reading inputs from stdin: %v", err)
+		}
+		return res, nil
+	}
+
+	fi, statErr := os.Stat(input)
+	if statErr == nil && fi.IsDir() {
+		entries, err := os.ReadDir(input)
+		if err != nil {
+			return nil, errors.Errorf("reading directory %s: %v", input, err)
+		}
+		var res []string
+		for _, e := range entries {
+			if !e.IsDir() && imageExts[strings.ToLower(path.Ext(e.Name()))] {
+				res = append(res, path.Join(input, e.Name()))
+			}
+		}
+		if len(res) == 0 {
+			return nil, errors.Errorf("no images in %s", input)
+		}
+		return res, nil
+	}
+
+	if statErr != nil && strings.ContainsAny(input, "*?[") {
+		res, err := filepath.Glob(input)
+		if err != nil {
+			return nil, errors.Errorf("invalid glob %s: %v", input, err)
+		}
+		if len(res) == 0 {
+			return nil, errors.Errorf("no files match %s", input)
+		}
+		sort.Strings(res)
+		return res, nil
+	}
+
+	return []string{input}, nil
+}
+
+// ConvertBatch converts each of inputs like Convert, running up to Jobs at
+// once, and returns the outputs in the order of the inputs. A failed input
+// doesn't stop the others; all the failures are returned as one error.
+func ConvertBatch(inputs []string, cOpts ...ConvertOption) ([]string, error) {
+	opts := MakeConvertOptions(cOpts...)
+	if len(inputs) > 1 && opts.OutputFile() != "" {
+		return nil, errors.Errorf("you cannot specify an output with >1 input")
+	}
+
+	type inputResult struct {
+		outputs []string
+		results []resultJSON
+	}
+	inputResults := make([]inputResult, len(inputs))
+	indices := make(chan int)
+	go func() {
+		for i := range inputs {
+			indices <- i
+		}
+		close(indices)
+	}()
+
+	ec := goutilerrors.MakeSyncErrorCollector()
+	var failed int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, jobs := 0, or.Int(opts.Jobs(), runtime.NumCPU()); i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				outputs, results, err := convertInput(inputs[i], opts)
+				if err != nil {
+					log.Printf("failed to convert %s: %v", inputs[i], err)
+					ec.Add(errors.Errorf("%s: %v", inputs[i], err))
+					mu.Lock()
+					failed++
+					mu.Unlock()
+					continue
+				}
+				inputResults[i] = inputResult{outputs, results}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var outputs []string
+	var results []resultJSON
+	for _, r := range inputResults {
+		outputs = append(outputs, r.outputs...)
+		results = append(results, r.results...)
+	}
+	log.Printf("converted %d of %d inputs to %d outputs, %d failed", len(inputs)-failed, len(inputs), len(outputs), failed)
+
+	if opts.ResultJSON() != "" {
+		if err := writeResultJSON(opts.ResultJSON(), results); err != nil {
+			ec.Add(err)
+		}
+	}
+	if !ec.Empty() {
+		return outputs, ec.Build()
+	}
+	return outputs, nil
+}
@@ -0,0 +1,76 @@
+package convert
+
+import (
+	"image/png"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeTestPNG(t *testing.T, file string, seed int64) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, randomImage(8, 8, seed)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, path.Join(dir, "a.png"), 1)
+	writeTestPNG(t, path.Join(dir, "b.png"), 2)
+	os.WriteFile(path.Join(dir, "notes.txt"), []byte("hi"), 0644)
+	bracketed := path.Join(t.TempDir(), "shot [1].png")
+	writeTestPNG(t, bracketed, 3)
+
+	for _, test := range []struct {
+		input, stdin string
+		want         []string
+	}{
+		{dir, "", []string{path.Join(dir, "a.png"), path.Join(dir, "b.png")}},
+		{path.Join(dir, "b*"), "", []string{path.Join(dir, "b.png")}},
+		{"-", "x.png\n\n  y.jpg \n", []string{"x.png", "y.jpg"}},
+		{"z.png", "", []string{"z.png"}},
+		{bracketed, "", []string{bracketed}},
+	} {
+		got, err := ExpandInputs(test.input, strings.NewReader(test.stdin))
+		if err != nil {
+			t.Fatalf("ExpandInputs(%q): %v", test.input, err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ExpandInputs(%q) = %v, want %v", test.input, got, test.want)
+		}
+	}
+	if _, err := ExpandInputs(path.Join(dir, "*.bmp"), nil); err == nil {
+		t.Errorf("ExpandInputs of a glob without matches succeeded")
+	}
+	if _, err := ExpandInputs(t.TempDir(), nil); err == nil {
+		t.Errorf("ExpandInputs of a directory without images succeeded")
+	}
+}
+
+func TestConvertBatchCollectsErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPNG(t, path.Join(dir, "a.png"), 1)
+	writeTestPNG(t, path.Join(dir, "b.png"), 2)
+	os.WriteFile(path.Join(dir, "broken.png"), []byte("not a png"), 0644)
+	inputs, err := ExpandInputs(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs, err := ConvertBatch(inputs, ConvertConverters([]string{"block_mean"}), ConvertBlockSize(4),
+		ConvertOutputDir(path.Join(dir, "out")), ConvertJobs(2))
+	if err == nil || !strings.Contains(err.Error(), "broken.png") {
+		t.Errorf("err = %v, want one about broken.png", err)
+	}
+	want := []string{path.Join(dir, "out", "a-block_mean-0004.png"), path.Join(dir, "out", "b-block_mean-0004.png")}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+}
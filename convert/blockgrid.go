@@ -0,0 +1,86 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+// BlockGrid is an image made of solid square blocks, like the output of the
+// block converters. Blocks on the right and bottom edges are clipped to Bounds.
+type BlockGrid struct {
+	Bounds    image.Rectangle
+	BlockSize int
+	// Colors of the blocks indexed by [row][col].
+	Colors [][]color.Color
+}
+
+// colorHist counts the blocks of each color, keyed by hex.
+func (g *BlockGrid) colorHist() map[string]int {
+	res := map[string]int{}
+	for _, row := range g.Colors {
+		for _, c := range row {
+			res[colorHex(c)]++
+		}
+	}
+	return res
+}
+
+// sampleBlocks returns the grid of img, whose blocks must be solid, taking the
+// color of each block from its top left pixel.
+func sampleBlocks(img image.Image, blockSize int) *BlockGrid {
+	b := img.Bounds()
+	g := &BlockGrid{Bounds: b, BlockSize: blockSize}
+	for y := b.Min.Y; y < b.Max.Y; y += blockSize {
+		var row []color.Color
+		for x := b.Min.X; x < b.Max.X; x += blockSize {
+			row = append(row, img.At(x, y))
+		}
+		g.Colors = append(g.Colors, row)
+	}
+	return g
+}
+
+// svg returns g as an SVG document with one rect per horizontal run of
+// blocks of the same color, skipping fully transparent ones.
+func (g *BlockGrid) svg() []byte {
+	w, h := g.Bounds.Dx(), g.Bounds.Dy()
+	var s strings.Builder
+	fmt.Fprintf(&s, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", w, h, w, h)
+	for r, row := range g.Colors {
+		y := r * g.BlockSize
+		height := intgr.Min(g.BlockSize, h-y)
+		for c := 0; c < len(row); {
+			end := c + 1
+			for end < len(row) && sameColor(row[end], row[c]) {
+				end++
+			}
+			if fill, opacity := svgColor(row[c]); opacity > 0 {
+				x := c * g.BlockSize
+				width := intgr.Min(end*g.BlockSize, w) - x
+				fmt.Fprintf(&s, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"`, x, y, width, height, fill)
+				if opacity < 255 {
+					fmt.Fprintf(&s, ` fill-opacity="%.3f"`, float64(opacity)/255)
+				}
+				s.WriteString("/>\n")
+			}
+			c = end
+		}
+	}
+	s.WriteString("</svg>\n")
+	return []byte(s.String())
+}
+
+func sameColor(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+// svgColor returns the hex fill of c and its opacity.
+func svgColor(c color.Color) (string, uint8) {
+	return colorHex(c), color.NRGBAModel.Convert(c).(color.NRGBA).A
+}
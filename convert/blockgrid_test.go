@@ -0,0 +1,52 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestBlockGridSVGMergesRuns(t *testing.T) {
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	g := &BlockGrid{
+		Bounds:    image.Rect(0, 0, 25, 10),
+		BlockSize: 10,
+		Colors:    [][]color.Color{{red, red, blue}},
+	}
+	got := string(g.svg())
+	for _, want := range []string{
+		`<rect x="0" y="0" width="20" height="10" fill="#ff0000"/>`,
+		// The last block is clipped to the bounds.
+		`<rect x="20" y="0" width="5" height="10" fill="#0000ff"/>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("svg missing %s:\n%s", want, got)
+		}
+	}
+	if n := strings.Count(got, "<rect"); n != 2 {
+		t.Errorf("svg has %d rects, want 2", n)
+	}
+}
+
+func TestBlockMeanHasBlocks(t *testing.T) {
+	img := randomImage(25, 15, 3)
+	res, err := blockMean("", img, MakeConvertOptions(ConvertBlockSize(5)))
+	if err != nil {
+		t.Fatalf("blockMean: %v", err)
+	}
+	g := res.Blocks()
+	if g == nil {
+		t.Fatal("no blocks")
+	}
+	if len(g.Colors) != 3 || len(g.Colors[0]) != 5 {
+		t.Fatalf("blocks = %dx%d, want 5x3", len(g.Colors[0]), len(g.Colors))
+	}
+	for y := 0; y < 15; y++ {
+		for x := 0; x < 25; x++ {
+			if !sameColor(res.Image().At(x, y), g.Colors[y/5][x/5]) {
+				t.Fatalf("pixel (%d, %d) doesn't match its block", x, y)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
+)
+
+const (
+	c64Width      = 320
+	c64Height     = 200
+	c64CellHeight = 8
+	// Multicolor pixels are twice as wide, so a cell is 4x8 of them.
+	c64MulticolorCellWidth = 4
+	c64HiresCellWidth      = 8
+)
+
+// c64Screen is a VIC-II bitmap. In multicolor mode the screen is 160x200
+// and every cell has the shared background color followed by 3 of its own;
+// in hires mode the screen is 320x200 and every cell has 2 colors of its own.
+type c64Screen struct {
+	*cellScreen
+	multicolor bool
+	background uint8
+}
+
+func makeC64Screen(inputImage image.Image, multicolor bool, space colorSpace) *c64Screen {
+	c64, _ := palette.Get("c64")
+	img := coverAndCrop(inputImage, c64Width, c64Height)
+
+	var all []uint8
+	for i := range c64.Colors {
+		all = append(all, uint8(i))
+	}
+
+	if !multicolor {
+		s := makeCellScreen(img, c64.Colors, c64HiresCellWidth, c64CellHeight, combinations(all, 2), space)
+		return &c64Screen{cellScreen: s}
+	}
+
+	img = resize.Resize(c64Width/2, c64Height, img, resize.Lanczos3)
+
+	// The background is shared by all cells, so use the most common color.
+	var counts [16]int
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			counts[nearestIn(space, img.At(x, y), c64.Colors)]++
+		}
+	}
+	background := mostCommon(counts[:], nil)[0]
+
+	var others []uint8
+	for _, c := range all {
+		if c != background {
+			others = append(others, c)
+		}
+	}
+	var choices [][]uint8
+	for _, c := range combinations(others, 3) {
+		choices = append(choices, append([]uint8{background}, c...))
+	}
+	s := makeCellScreen(img, c64.Colors, c64MulticolorCellWidth, c64CellHeight, choices, space)
+	return &c64Screen{cellScreen: s, multicolor: true, background: background}
+}
+
+func (s *c64Screen) image() image.Image {
+	img := s.cellScreen.image()
+	if !s.multicolor {
+		return img
+	}
+	// Double the width of multicolor pixels.
+	res := image.NewPaletted(image.Rect(0, 0, 2*s.width, s.height), img.Palette)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < 2*s.width; x++ {
+			res.SetColorIndex(x, y, img.ColorIndexAt(x/2, y))
+		}
+	}
+	return res
+}
+
+// koa returns the screen in the format of Koala Painter: the load address,
+// 8000 bytes of bitmap, 1000 of screen RAM, 1000 of color RAM and the
+// background color.
+func (s *c64Screen) koa() ([]byte, error) {
+	if !s.multicolor {
+		return nil, errors.Errorf("Koala Painter images must be multicolor")
+	}
+	const (
+		bitmap    = 2
+		screenRAM = bitmap + 8000
+		colorRAM  = screenRAM + 1000
+		bg        = colorRAM + 1000
+	)
+	res := make([]byte, bg+1)
+	res[0], res[1] = 0x00, 0x60
+	for cy := 0; cy < s.cellsHigh(); cy++ {
+		for cx := 0; cx < s.cellsWide(); cx++ {
+			cell := cy*s.cellsWide() + cx
+			for y := 0; y < c64CellHeight; y++ {
+				var b byte
+				for x := 0; x < c64MulticolorCellWidth; x++ {
+					b = b<<2 | s.pixels[(cy*c64CellHeight+y)*s.width+cx*c64MulticolorCellWidth+x]
+				}
+				res[bitmap+cell*c64CellHeight+y] = b
+			}
+			// Bit pairs 01 and 10 take their colors from the high and low
+			// nibbles of screen RAM, 11 from color RAM.
+			colors := s.cellColors[cell]
+			res[screenRAM+cell] = colors[1]<<4 | colors[2]
+			res[colorRAM+cell] = colors[3]
+		}
+	}
+	res[bg] = s.background
+	return res, nil
+}
+
+func (s *c64Screen) nativeFormats() map[string]nativeEncoder {
+	return map[string]nativeEncoder{
+		".koa": func() (map[string][]byte, error) {
+			b, err := s.koa()
+			if err != nil {
+				return nil, err
+			}
+			return map[string][]byte{".koa": b}, nil
+		},
+	}
+}
+
+func c64Multicolor(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	s := makeC64Screen(inputImage, true, colorSpaceOf(opts))
+	res := makeNativeConvertResult(s.image(), s, nil)
+	return res, nil
+}
+
+func c64Hires(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	s := makeC64Screen(inputImage, false, colorSpaceOf(opts))
+	res := makeNativeConvertResult(s.image(), s, nil)
+	return res, nil
+}
+
+type c64Converter struct{ baseConverter }
+
+func (c *c64Converter) OutputFileName(input string, opts ConvertOptions) string {
+	ext := path.Ext(input)
+	base := strings.Replace(path.Base(input), ext, "", 1)
+	return fmt.Sprintf("%s-%s%s", base, c.Name(), ext)
+}
+
+func init() {
+	globalReg.Register(&c64Converter{
+		baseConverter{
+			name: "c64_multicolor",
+			conv: c64Multicolor,
+		}})
+	globalReg.Register(&c64Converter{
+		baseConverter{
+			name: "c64_hires",
+			conv: c64Hires,
+		}})
+}
@@ -0,0 +1,75 @@
+package convert
+
+import "testing"
+
+func TestC64CellBudgets(t *testing.T) {
+	img := randomImage(200, 150, 2)
+	for _, tc := range []struct {
+		multicolor            bool
+		width, cellWidth, max int
+	}{
+		{true, c64Width / 2, c64MulticolorCellWidth, 4},
+		{false, c64Width, c64HiresCellWidth, 2},
+	} {
+		s := makeC64Screen(img, tc.multicolor, colorSpaceSRGB)
+		if s.width != tc.width || s.height != c64Height {
+			t.Fatalf("multicolor=%t: size = %dx%d, want %dx%d", tc.multicolor, s.width, s.height, tc.width, c64Height)
+		}
+		for cy := 0; cy < s.height; cy += c64CellHeight {
+			for cx := 0; cx < s.width; cx += tc.cellWidth {
+				colors := map[uint8]bool{}
+				for y := cy; y < cy+c64CellHeight; y++ {
+					for x := cx; x < cx+tc.cellWidth; x++ {
+						colors[s.colorIndexAt(x, y)] = true
+					}
+				}
+				if len(colors) > tc.max {
+					t.Fatalf("multicolor=%t: cell at (%d,%d) has %d colors, want <= %d", tc.multicolor, cx, cy, len(colors), tc.max)
+				}
+				if cellColors := s.cellColors[s.cellAt(cx, cy)]; tc.multicolor && cellColors[0] != s.background {
+					t.Fatalf("cell at (%d,%d) doesn't start with the background", cx, cy)
+				}
+			}
+		}
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	if got := len(combinations([]uint8{0, 1, 2, 3, 4}, 3)); got != 10 {
+		t.Errorf("combinations(5, 3) = %d, want 10", got)
+	}
+}
+
+func TestC64KoalaMatchesImage(t *testing.T) {
+	s := makeC64Screen(randomImage(200, 150, 4), true, colorSpaceSRGB)
+	koa, err := s.koa()
+	if err != nil {
+		t.Fatalf("koa: %v", err)
+	}
+	if len(koa) != 10003 {
+		t.Fatalf("len(koa) = %d, want 10003", len(koa))
+	}
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			cell := (y/8)*40 + x/4
+			bits := koa[2+cell*8+y%8] >> (6 - 2*(x%4)) & 3
+			var c uint8
+			switch bits {
+			case 0:
+				c = koa[10002]
+			case 1:
+				c = koa[8002+cell] >> 4
+			case 2:
+				c = koa[8002+cell] & 0x0F
+			case 3:
+				c = koa[9002+cell]
+			}
+			if want := s.colorIndexAt(x, y); c != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, c, want)
+			}
+		}
+	}
+	if _, err := makeC64Screen(randomImage(10, 10, 5), false, colorSpaceSRGB).koa(); err == nil {
+		t.Errorf("koa: expected error for hires")
+	}
+}
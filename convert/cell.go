@@ -0,0 +1,130 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// cellScreen is an image split into cells that, like on 8-bit hardware with
+// color attributes, may each only use a limited set of colors from a palette.
+type cellScreen struct {
+	// In pixels, multiples of the cell size.
+	width, height         int
+	cellWidth, cellHeight int
+	palette               color.Palette
+	// Per cell, row-major, the indices into palette the cell may use.
+	cellColors [][]uint8
+	// Per pixel, row-major, the index into the colors of the pixel's cell.
+	pixels []uint8
+}
+
+func (s *cellScreen) cellsWide() int { return s.width / s.cellWidth }
+func (s *cellScreen) cellsHigh() int { return s.height / s.cellHeight }
+
+func (s *cellScreen) cellAt(x, y int) int {
+	return (y/s.cellHeight)*s.cellsWide() + x/s.cellWidth
+}
+
+// colorIndexAt returns the index into palette of the pixel at (x, y).
+func (s *cellScreen) colorIndexAt(x, y int) uint8 {
+	return s.cellColors[s.cellAt(x, y)][s.pixels[y*s.width+x]]
+}
+
+func (s *cellScreen) image() *image.Paletted {
+	res := image.NewPaletted(image.Rect(0, 0, s.width, s.height), s.palette)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			res.SetColorIndex(x, y, s.colorIndexAt(x, y))
+		}
+	}
+	return res
+}
+
+// makeCellScreen picks, for each cellWidth x cellHeight cell of img, the one
+// of choices, the color budgets allowed by the hardware, that is closest to
+// the cell's pixels and then maps each pixel to the nearest color of it.
+// img's size must be a multiple of the cell size. Distances are measured in space.
+func makeCellScreen(img image.Image, p color.Palette, cellWidth, cellHeight int, choices [][]uint8, space colorSpace) *cellScreen {
+	bounds := img.Bounds()
+	s := &cellScreen{
+		width:      bounds.Dx(),
+		height:     bounds.Dy(),
+		cellWidth:  cellWidth,
+		cellHeight: cellHeight,
+		palette:    p,
+		pixels:     make([]uint8, bounds.Dx()*bounds.Dy()),
+	}
+	s.cellColors = make([][]uint8, s.cellsWide()*s.cellsHigh())
+
+	// dists[i][c] is the distance from pixel i of the current cell to color c.
+	dists := make([][]float64, cellWidth*cellHeight)
+	for i := range dists {
+		dists[i] = make([]float64, len(p))
+	}
+	for cy := 0; cy < s.cellsHigh(); cy++ {
+		for cx := 0; cx < s.cellsWide(); cx++ {
+			for y := 0; y < cellHeight; y++ {
+				for x := 0; x < cellWidth; x++ {
+					c := img.At(bounds.Min.X+cx*cellWidth+x, bounds.Min.Y+cy*cellHeight+y)
+					for i, pc := range p {
+						dists[y*cellWidth+x][i] = sqDiffIn(space, c, pc)
+					}
+				}
+			}
+
+			best, bestErr := 0, math.MaxFloat64
+			for i, choice := range choices {
+				var err float64
+				for _, d := range dists {
+					nearest := math.MaxFloat64
+					for _, c := range choice {
+						if d[c] < nearest {
+							nearest = d[c]
+						}
+					}
+					err += nearest
+					if err >= bestErr {
+						break
+					}
+				}
+				if err < bestErr {
+					best, bestErr = i, err
+				}
+			}
+
+			choice := choices[best]
+			s.cellColors[cy*s.cellsWide()+cx] = choice
+			for y := 0; y < cellHeight; y++ {
+				for x := 0; x < cellWidth; x++ {
+					d := dists[y*cellWidth+x]
+					var v uint8
+					for i, c := range choice {
+						if d[c] < d[choice[v]] {
+							v = uint8(i)
+						}
+					}
+					s.pixels[(cy*cellHeight+y)*s.width+cx*cellWidth+x] = v
+				}
+			}
+		}
+	}
+	return s
+}
+
+// combinations returns every k-element subset of colors, in order.
+func combinations(colors []uint8, k int) [][]uint8 {
+	var res [][]uint8
+	var rec func(start int, cur []uint8)
+	rec = func(start int, cur []uint8) {
+		if len(cur) == k {
+			res = append(res, append([]uint8{}, cur...))
+			return
+		}
+		for i := start; i < len(colors); i++ {
+			rec(i+1, append(cur, colors[i]))
+		}
+	}
+	rec(0, nil)
+	return res
+}
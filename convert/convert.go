@@ -3,11 +3,14 @@ package convert
 import (
 	"fmt"
 	"image"
+	"image/color"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
+	goio "io"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,38 +18,59 @@ import (
 	"github.com/noelyahan/impexp"
 	"github.com/noelyahan/mergi"
 	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
 	"github.com/spudtrooper/goutil/hist"
 	"github.com/spudtrooper/goutil/io"
 	"github.com/spudtrooper/goutil/or"
 	"github.com/spudtrooper/goutil/slice"
 )
 
+// stdoutOutput as the output file prints text results instead of writing them.
+const stdoutOutput = "-"
+
 func Convert(input string, cOpts ...ConvertOption) ([]string, error) {
 	opts := MakeConvertOptions(cOpts...)
-
-	switch ext := path.Ext(input); ext {
-	case ".png", ".jpg", ".jpeg":
-	default:
-		return nil, errors.Errorf("invalid input image type: %s", input)
+	outputs, results, err := convertInput(input, opts)
+	if err != nil {
+		return nil, err
 	}
+	if opts.ResultJSON() != "" {
+		if err := writeResultJSON(opts.ResultJSON(), results); err != nil {
+			return nil, err
+		}
+	}
+	return outputs, nil
+}
 
-	inputImage, err := decode(input)
+// convertInput is Convert without writing the results as JSON.
+func convertInput(input string, opts ConvertOptions) ([]string, []resultJSON, error) {
+	inputImage, format, err := decode(input)
 	if err != nil {
-		return nil, errors.Errorf("decoding input image: %s", input)
+		return nil, nil, err
+	}
+	// Outputs are named after the input and most keep its extension, so
+	// name them after the format of the input if its extension is off.
+	outputName := input
+	if ext := strings.ToLower(path.Ext(input)); ext != formatExt(format) && !(ext == ".jpeg" && format == "jpeg") {
+		outputName = strings.TrimSuffix(input, path.Ext(input)) + formatExt(format)
 	}
 
 	if opts.ColorHist() {
 		colorHist := hist.MakeHistogram()
 		for y := inputImage.Bounds().Min.Y; y < inputImage.Bounds().Max.Y; y++ {
 			for x := inputImage.Bounds().Min.X; x < inputImage.Bounds().Max.X; x++ {
-				c := inputImage.At(x, y)
-				colorHist.Add(colorName(c), 1)
+				colorHist.Add(colorName(inputImage.At(x, y)), 1)
 			}
 		}
 		fmt.Println("Printing color histogram...")
 		fmt.Println(hist.HistString(colorHist))
 	}
 
+	pal, err := paletteFor(inputImage, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	converters := opts.Converters()
 	if len(converters) == 1 && converters[0] == "all" {
 		if len(opts.Except()) > 0 {
@@ -57,80 +81,282 @@ func Convert(input string, cOpts ...ConvertOption) ([]string, error) {
 	}
 	if len(converters) == 0 {
 		if opts.ColorHist() {
-			return nil, nil
+			return nil, nil, nil
 		}
-		return nil, errors.Errorf("you must specify at least one converter")
+		return nil, nil, errors.Errorf("you must specify at least one converter")
 	}
 	if len(converters) > 1 && opts.OutputFile() != "" {
-		return nil, errors.Errorf("you cannot specify an output with >1 converter")
+		return nil, nil, errors.Errorf("you cannot specify an output with >1 converter")
 	}
 
 	var outputs []string
+	var results []resultJSON
 	for _, convName := range converters {
-		conv := globalReg.Get(convName)
-		if conv == nil {
-			return nil, errors.Errorf("invalid converter string: %s", convName)
+		conv, err := globalReg.Lookup(convName)
+		if err != nil {
+			return nil, nil, err
 		}
-		output := or.String(opts.OutputFile(), makeOutput(conv, input, opts.OutputDir(), opts))
-		if !opts.Force() && io.FileExists(output) {
-			return nil, errors.Errorf("%s exists. pass --force to write anyway", output)
+		output := or.String(opts.OutputFile(), makeOutput(conv, outputName, opts.OutputDir(), opts))
+		if !mayOverwrite(output, opts) && io.FileExists(output) {
+			return nil, nil, errors.Errorf("%s exists. pass --force to write anyway", output)
 		}
-		if err := convertOne(inputImage, input, output, conv, opts); err != nil {
-			return nil, errors.Errorf("converting %s to %s: %v", input, output, err)
+		res, err := convertOne(inputImage, input, output, conv, pal, opts)
+		if err != nil {
+			return nil, nil, errors.Errorf("converting %s to %s: %v", input, output, err)
 		}
 		outputs = append(outputs, output)
+		results = append(results, makeResultJSON(input, output, conv, res))
 	}
 
-	return outputs, nil
+	return outputs, results, nil
 }
 
-func convertOne(inputImage image.Image, input, output string, conv Converter, opts ConvertOptions) error {
+func convertOne(inputImage image.Image, input, output string, conv Converter, pal color.Palette, opts ConvertOptions) (ConvertResult, error) {
 	start := time.Now()
 
-	outputImgRes, err := conv.Convert(input, inputImage, opts)
+	outputImgRes, err := convertImage(inputImage, input, conv, pal, opts)
 	if err != nil {
-		return errors.Errorf("converting image: %v", err)
-	}
-	if outputImgRes == nil {
-		return errors.Errorf("converting image returned nil image")
+		return nil, err
 	}
 
-	if opts.ResizeWidth() != 0 && opts.ResizeHeight() != 0 {
-		outputImg := resize.Resize(opts.ResizeWidth(), opts.ResizeHeight(), outputImgRes.Image(), resize.Lanczos3)
-		outputImgRes = makeImageConvertResult(outputImg)
+	if output == stdoutOutput {
+		if outputImgRes.Text() == "" {
+			return nil, errors.Errorf("only text converters, e.g. ascii, can write to stdout")
+		}
+		fmt.Print(outputImgRes.Text())
+		return outputImgRes, nil
 	}
 
-	if !opts.Force() && io.FileExists(output) {
-		return errors.Errorf("%s exists. pass --force to write anyway", output)
+	if !mayOverwrite(output, opts) && io.FileExists(output) {
+		return nil, errors.Errorf("%s exists. pass --force to write anyway", output)
+	}
+	// Check the sidecars first so nothing is written if any of them exists.
+	for ext := range outputImgRes.Sidecars() {
+		if sidecar := companionFile(output, ext); !mayOverwrite(sidecar, opts) && io.FileExists(sidecar) {
+			return nil, errors.Errorf("%s exists. pass --force to write anyway", sidecar)
+		}
 	}
 	if _, err := io.MkdirAll(path.Dir(output)); err != nil {
-		return errors.Errorf("making directory for %s", output)
+		return nil, errors.Errorf("making directory for %s", output)
+	}
+	if err := encode(output, outputImgRes, opts); err != nil {
+		return nil, errors.Errorf("encoding image to %s: %v", output, err)
+	}
+	for ext, b := range outputImgRes.Sidecars() {
+		sidecar := companionFile(output, ext)
+		if err := os.WriteFile(sidecar, b, 0644); err != nil {
+			return nil, errors.Errorf("writing %s: %v", sidecar, err)
+		}
+		log.Printf("wrote %s", sidecar)
 	}
-	if err := encode(output, outputImgRes); err != nil {
-		return errors.Errorf("encoding image to %s: %v", output, err)
+	if opts.Tileset() && outputImgRes.Image() != nil {
+		if err := writeTileset(output, outputImgRes.Image(), opts); err != nil {
+			return nil, errors.Errorf("writing tileset for %s: %v", output, err)
+		}
 	}
 
 	log.Printf("converted %s to %s in %v", input, output, time.Since(start))
 
-	return nil
+	return outputImgRes, nil
+}
+
+// paletteFor returns the palette to reduce the outputs of converting
+// inputImage to, or nil if there's none.
+func paletteFor(inputImage image.Image, opts ConvertOptions) (color.Palette, error) {
+	var colorCounts map[color.RGBA]int
+	if opts.PaletteSize() > 0 {
+		colorCounts = map[color.RGBA]int{}
+		for y := inputImage.Bounds().Min.Y; y < inputImage.Bounds().Max.Y; y++ {
+			for x := inputImage.Bounds().Min.X; x < inputImage.Bounds().Max.X; x++ {
+				colorCounts[color.RGBAModel.Convert(inputImage.At(x, y)).(color.RGBA)]++
+			}
+		}
+	}
+	pal, err := loadPalette(opts, colorCounts)
+	if err != nil {
+		return nil, err
+	}
+	if err := palette.ValidateDither(palette.Dither(opts.Dither())); err != nil {
+		return nil, err
+	}
+	if err := validateColorSpace(colorSpaceOf(opts)); err != nil {
+		return nil, err
+	}
+	return pal, nil
+}
+
+// postProcess resizes the image of res, made by conv, and reduces it to pal,
+// as requested in opts.
+func postProcess(res ConvertResult, conv Converter, pal color.Palette, opts ConvertOptions) (ConvertResult, error) {
+	resizing := opts.ResizeWidth() != 0 && opts.ResizeHeight() != 0 && res.Image() != nil && !sizesOutput(conv) && !hasSize(res.Image(), opts.ResizeWidth(), opts.ResizeHeight())
+	// Sidecars are made from the image before either, so they'd no longer match.
+	if (resizing || pal != nil && res.Image() != nil) && len(res.Sidecars()) > 0 {
+		var exts []string
+		for ext := range res.Sidecars() {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		return nil, errors.Errorf("cannot write %s files of an image that's resized or reduced to a palette afterwards", strings.Join(exts, ", "))
+	}
+	if resizing {
+		outputImg := resize.Resize(opts.ResizeWidth(), opts.ResizeHeight(), res.Image(), resize.Lanczos3)
+		res = withImage(res, outputImg)
+	}
+
+	if pal != nil && res.Image() != nil {
+		outputImg, err := palette.ApplyDitheredIn(res.Image(), pal, palette.Dither(opts.Dither()), paletteSpace(opts))
+		if err != nil {
+			return nil, errors.Errorf("applying palette: %v", err)
+		}
+		blocks := res.Blocks()
+		res = withImage(res, outputImg)
+		// Without dithering each block maps onto a single palette color.
+		if blocks != nil && opts.Dither() == "" {
+			res = withBlocks(res, sampleBlocks(outputImg, blocks.BlockSize))
+		}
+		res = withPalette(res, pal)
+	}
+	return res, nil
+}
+
+// sizingConverter is implemented by converters that size their output from
+// ResizeWidth and ResizeHeight themselves, e.g. to whole tiles, so it mustn't
+// be resized again.
+type sizingConverter interface {
+	sizesOutput() bool
+}
+
+func sizesOutput(c Converter) bool {
+	s, ok := c.(sizingConverter)
+	return ok && s.sizesOutput()
+}
+
+func hasSize(img image.Image, width, height uint) bool {
+	return img != nil && img.Bounds().Dx() == int(width) && img.Bounds().Dy() == int(height)
 }
 
 func makeOutput(c Converter, input, outputDir string, opts ConvertOptions) string {
 	dir := or.String(outputDir, path.Dir(input))
 	output := c.OutputFileName(input, opts)
+	// Dithering only applies when reducing to a palette.
+	dither := ""
+	if paletteTag(opts) != "" {
+		dither = opts.Dither()
+	}
+	for _, tag := range []string{paletteTag(opts), dither, colorSpaceTag(opts)} {
+		if tag != "" {
+			ext := path.Ext(output)
+			output = strings.TrimSuffix(output, ext) + "-" + tag + ext
+		}
+	}
 	return path.Join(dir, output)
 }
 
-func encode(output string, res ConvertResult) error {
+// encode writes res to output and, for native formats, its companion files,
+// which must not exist unless they may be overwritten.
+func encode(output string, res ConvertResult, opts ConvertOptions) error {
+	ext := strings.ToLower(path.Ext(output))
+	if native := nativeOf(res); native != nil {
+		if enc, ok := native.nativeFormats()[ext]; ok {
+			return encodeNative(output, enc, opts)
+		}
+	}
+	if res.Image() == nil && res.Text() == "" && len(res.GIF().Image) > 0 {
+		return encodeGIF(output, res.GIF())
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return errors.Errorf("creating %s: %v", output, err)
+	}
+	if err := encodeTo(out, ext, res); err != nil {
+		out.Close()
+		return errors.Errorf("encoding %s: %v", output, err)
+	}
+	if err := out.Close(); err != nil {
+		return errors.Errorf("closing %s: %v", output, err)
+	}
+	return nil
+}
+
+// encodeTo writes res to w in the format of the extension ext. Of a native
+// format with companion files only the main file is written.
+func encodeTo(w goio.Writer, ext string, res ConvertResult) error {
+	if ext == ".svg" {
+		if res.Blocks() == nil {
+			return errors.Errorf("only block converters, e.g. block_median, can write .svg")
+		}
+		_, err := w.Write(res.Blocks().svg())
+		return err
+	}
+	if native := nativeOf(res); native != nil {
+		if enc, ok := native.nativeFormats()[ext]; ok {
+			files, err := enc()
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(files[ext])
+			return err
+		}
+	}
+	if res.Text() != "" {
+		_, err := goio.WriteString(w, res.Text())
+		return err
+	}
 	if res.Image() != nil {
-		return encodeImage(output, res.Image())
+		return writeImage(w, ext, res.Image())
 	}
 	if len(res.GIF().Image) > 0 {
-		return encodeGIF(output, res.GIF())
+		if ext != ".gif" {
+			return errors.Errorf("animations can only be written as .gif, not %s", ext)
+		}
+		g := res.GIF()
+		return gif.EncodeAll(w, &g)
 	}
 	return errors.Errorf("no image in result")
 }
 
+func encodeNative(output string, enc nativeEncoder, opts ConvertOptions) error {
+	files, err := enc()
+	if err != nil {
+		return err
+	}
+	for ext := range files {
+		if f := companionFile(output, ext); f != output && !mayOverwrite(f, opts) && io.FileExists(f) {
+			return errors.Errorf("%s exists. pass --force to write anyway", f)
+		}
+	}
+	for ext, b := range files {
+		f := companionFile(output, ext)
+		if err := os.WriteFile(f, b, 0644); err != nil {
+			return errors.Errorf("writing %s: %v", f, err)
+		}
+	}
+	return nil
+}
+
+// mayOverwrite returns whether file may be written over if it exists: always
+// with Force, or else if it's one of Overwrite or a file written next to one,
+// i.e. a companion file, sidecar or tileset.
+func mayOverwrite(file string, opts ConvertOptions) bool {
+	if opts.Force() {
+		return true
+	}
+	for _, o := range opts.Overwrite() {
+		base := strings.TrimSuffix(o, path.Ext(o))
+		if file == o || strings.TrimSuffix(file, path.Ext(file)) == base ||
+			strings.HasPrefix(file, base+"-tileset.") || strings.HasPrefix(file, base+"-tilemap.") {
+			return true
+		}
+	}
+	return false
+}
+
+// companionFile is the file next to output with the extension ext.
+func companionFile(output, ext string) string {
+	return strings.TrimSuffix(output, path.Ext(output)) + ext
+}
+
 func encodeGIF(output string, gif gif.GIF) error {
 	return mergi.Export(impexp.NewAnimationExporter(gif, output))
 }
@@ -140,49 +366,38 @@ func encodeImage(output string, outputImg image.Image) error {
 	if err != nil {
 		return errors.Errorf("creating output image from %s: %v", output, err)
 	}
-
-	switch ext := strings.ToLower(path.Ext(output)); ext {
-	case ".png":
-		png.Encode(out, outputImg)
-	case ".jpg", ".jpeg":
-		jpeg.Encode(out, outputImg, &jpeg.Options{})
-	default:
-		return errors.Errorf("unknown output image format for %s:", output)
+	if err := writeImage(out, strings.ToLower(path.Ext(output)), outputImg); err != nil {
+		out.Close()
+		return errors.Errorf("encoding %s: %v", output, err)
 	}
-
 	if err := out.Close(); err != nil {
 		return errors.Errorf("closing %s: %v", output, err)
 	}
-
 	return nil
 }
 
-func decode(input string) (image.Image, error) {
-	inputFile, err := os.Open(input)
-	if err != nil {
-		return nil, errors.Errorf("opening %s: %v", input, err)
-	}
-	defer inputFile.Close()
-
-	switch ext := strings.ToLower(path.Ext(input)); ext {
+func writeImage(w goio.Writer, ext string, img image.Image) error {
+	switch ext {
 	case ".png":
-		img, err := png.Decode(inputFile)
-		if err != nil {
-			return nil, errors.Errorf("decoding png %s: %v", input, err)
-		}
-		return img, nil
+		return png.Encode(w, img)
 	case ".jpg", ".jpeg":
-		img, err := jpeg.Decode(inputFile)
-		if err != nil {
-			return nil, errors.Errorf("decoding jpg %s: %v", input, err)
-		}
-		return img, nil
+		return jpeg.Encode(w, img, &jpeg.Options{})
+	case ".gif":
+		return gif.Encode(w, img, nil)
 	}
+	return errors.Errorf("unknown output image format: %s", ext)
+}
 
-	img, _, err := image.Decode(inputFile)
+func decode(input string) (image.Image, string, error) {
+	inputFile, err := os.Open(input)
 	if err != nil {
-		return nil, errors.Errorf("decoding %s: %v", input, err)
+		return nil, "", errors.Errorf("opening %s: %v", input, err)
 	}
+	defer inputFile.Close()
 
-	return img, nil
+	img, format, err := decodeReader(inputFile)
+	if err != nil {
+		return nil, "", errors.Errorf("%s: %v", input, err)
+	}
+	return img, format, nil
 }
@@ -0,0 +1,21 @@
+package convert
+
+import "testing"
+
+func TestMakeOutputTags(t *testing.T) {
+	conv := globalReg.Get("block_mean")
+	for _, test := range []struct {
+		name string
+		opts []ConvertOption
+		want string
+	}{
+		{"plain", nil, "in/a-block_mean-0004.png"},
+		{"dithered palette", []ConvertOption{ConvertPalette("nes"), ConvertDither("floyd_steinberg")}, "in/a-block_mean-0004-nes-floyd_steinberg.png"},
+		{"dither without palette", []ConvertOption{ConvertDither("floyd_steinberg")}, "in/a-block_mean-0004.png"},
+	} {
+		opts := MakeConvertOptions(append(test.opts, ConvertBlockSize(4))...)
+		if got := makeOutput(conv, "in/a.png", "", opts); got != test.want {
+			t.Errorf("%s: makeOutput = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -2,30 +2,147 @@ package convert
 
 import (
 	"image"
+	"image/color"
 	"image/gif"
+	"time"
 )
 
 type ConvertResult interface {
 	Image() image.Image
 	GIF() gif.GIF
+	// Sidecars are extra files to write next to the output, keyed by their extension, e.g. ".scr".
+	Sidecars() map[string][]byte
+	// Text is the output of converters that produce text instead of an image, e.g. "ascii".
+	Text() string
+	// Blocks is the grid of solid blocks the image is made of, for block converters, or nil.
+	Blocks() *BlockGrid
+	// Palette is the palette the image was reduced to, or nil.
+	Palette() color.Palette
+	// ColorHist counts the blocks of each color, keyed by hex, for block and overlap converters,
+	// or is nil if the blocks were lost to resizing or dithering.
+	ColorHist() map[string]int
+	// Duration is how long the conversion took, including resizing and reducing to a palette.
+	Duration() time.Duration
 }
 
 type convertResult struct {
-	image image.Image
-	gif   gif.GIF
+	image     image.Image
+	gif       gif.GIF
+	sidecars  map[string][]byte
+	native    nativeScreen
+	text      string
+	blocks    *BlockGrid
+	palette   color.Palette
+	colorHist map[string]int
+	duration  time.Duration
 }
 
-func (r *convertResult) Image() image.Image { return r.image }
-func (r *convertResult) GIF() gif.GIF       { return r.gif }
+func (r *convertResult) Image() image.Image          { return r.image }
+func (r *convertResult) GIF() gif.GIF                { return r.gif }
+func (r *convertResult) Sidecars() map[string][]byte { return r.sidecars }
+func (r *convertResult) Text() string                { return r.text }
+func (r *convertResult) Blocks() *BlockGrid          { return r.blocks }
+func (r *convertResult) ColorHist() map[string]int   { return r.colorHist }
+func (r *convertResult) Duration() time.Duration     { return r.duration }
+
+func (r *convertResult) Palette() color.Palette {
+	if r.palette != nil {
+		return r.palette
+	}
+	if p, ok := r.image.(*image.Paletted); ok {
+		return p.Palette
+	}
+	return nil
+}
 
 func makeImageConvertResult(image image.Image) ConvertResult {
 	return &convertResult{image: image}
 }
 
+func makeBlocksConvertResult(image image.Image, blocks *BlockGrid, colorHist map[string]int) ConvertResult {
+	return &convertResult{image: image, blocks: blocks, colorHist: colorHist}
+}
+
+func makeNativeConvertResult(image image.Image, native nativeScreen, sidecars map[string][]byte) ConvertResult {
+	return &convertResult{image: image, native: native, sidecars: sidecars}
+}
+
+// copyResult returns a copy of res that can be modified.
+func copyResult(res ConvertResult) *convertResult {
+	if r, ok := res.(*convertResult); ok {
+		c := *r
+		return &c
+	}
+	return &convertResult{
+		image:     res.Image(),
+		gif:       res.GIF(),
+		sidecars:  res.Sidecars(),
+		text:      res.Text(),
+		blocks:    res.Blocks(),
+		palette:   res.Palette(),
+		colorHist: res.ColorHist(),
+		duration:  res.Duration(),
+	}
+}
+
+// withImage replaces the image of res, e.g. after resizing it, keeping the rest
+// except for the blocks, color histogram, palette, native screen and sidecars,
+// which no longer match the image.
+func withImage(res ConvertResult, image image.Image) ConvertResult {
+	r := copyResult(res)
+	r.image, r.blocks, r.colorHist, r.palette, r.native, r.sidecars = image, nil, nil, nil, nil, nil
+	return r
+}
+
+// withBlocks replaces the blocks of res, and its color histogram with that of
+// the blocks, keeping the rest.
+func withBlocks(res ConvertResult, blocks *BlockGrid) ConvertResult {
+	r := copyResult(res)
+	r.blocks, r.colorHist = blocks, blocks.colorHist()
+	return r
+}
+
+// withPalette records that the image of res was reduced to p.
+func withPalette(res ConvertResult, p color.Palette) ConvertResult {
+	r := copyResult(res)
+	r.palette = p
+	return r
+}
+
+// withDuration records how long it took to make res.
+func withDuration(res ConvertResult, d time.Duration) ConvertResult {
+	r := copyResult(res)
+	r.duration = d
+	return r
+}
+
+// nativeScreen is implemented by screens reduced to the constraints of some
+// hardware, so they can be written in the hardware's own file formats.
+type nativeScreen interface {
+	// nativeFormats maps the extensions of the supported formats to their encoders.
+	nativeFormats() map[string]nativeEncoder
+}
+
+// nativeEncoder returns the contents of the files of a native format keyed by
+// extension: the file for the extension that selected the encoder and any
+// companion files to write next to it.
+type nativeEncoder func() (map[string][]byte, error)
+
+func nativeOf(res ConvertResult) nativeScreen {
+	if r, ok := res.(*convertResult); ok {
+		return r.native
+	}
+	return nil
+}
+
 func makeGIFConvertResult(gif gif.GIF) ConvertResult {
 	return &convertResult{gif: gif}
 }
 
+func makeTextConvertResult(text string) ConvertResult {
+	return &convertResult{text: text}
+}
+
 type Converter interface {
 	Convert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error)
 	Name() string
@@ -1,6 +1,6 @@
 package convert
 
-//go:generate genopts --prefix=Convert --outfile=convertoptions.go "blockSize:int" "animateBlockSizeRange:blockSizeRange" "pixelateBlockSize:int" "resizeWidth:uint" "resizeHeight:uint" "force:bool" "converters:[]string" "except:[]string" "outputDir:string" "outputFile:string" "colorHist:bool" "animateThreads:int" "animateReverse"
+//go:generate genopts --prefix=Convert --outfile=convertoptions.go "blockSize:int" "animateBlockSizeRange:blockSizeRange" "pixelateBlockSize:int" "resizeWidth:uint" "resizeHeight:uint" "force:bool" "converters:[]string" "except:[]string" "outputDir:string" "outputFile:string" "colorHist:bool" "animateThreads:int" "animateReverse" "pixelateResolution:uint" "palette:string" "paletteFile:string" "dither:string" "paletteSize:int" "paletteMethod:string" "gameboyGreen:bool" "zxScr:bool" "tileset:bool" "tileSize:int" "textMedian:bool" "resultJSON:string" "jobs:int" "threads:int" "colorSpace:string" "overwrite:[]string"
 
 type ConvertOption func(*convertOptionImpl)
 
@@ -18,6 +18,22 @@ type ConvertOptions interface {
 	ColorHist() bool
 	AnimateThreads() int
 	AnimateReverse() bool
+	PixelateResolution() uint
+	Palette() string
+	PaletteFile() string
+	Dither() string
+	PaletteSize() int
+	PaletteMethod() string
+	GameboyGreen() bool
+	ZxScr() bool
+	Tileset() bool
+	TileSize() int
+	TextMedian() bool
+	ResultJSON() string
+	Jobs() int
+	Threads() int
+	ColorSpace() string
+	Overwrite() []string
 }
 
 func ConvertBlockSize(blockSize int) ConvertOption {
@@ -163,6 +179,182 @@ func ConvertAnimateReverseFlag(animateReverse *bool) ConvertOption {
 	}
 }
 
+func ConvertPixelateResolution(pixelateResolution uint) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.pixelateResolution = pixelateResolution
+	}
+}
+func ConvertPixelateResolutionFlag(pixelateResolution *uint) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.pixelateResolution = *pixelateResolution
+	}
+}
+
+func ConvertPalette(palette string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.palette = palette
+	}
+}
+func ConvertPaletteFlag(palette *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.palette = *palette
+	}
+}
+
+func ConvertPaletteFile(paletteFile string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteFile = paletteFile
+	}
+}
+func ConvertPaletteFileFlag(paletteFile *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteFile = *paletteFile
+	}
+}
+
+func ConvertDither(dither string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.dither = dither
+	}
+}
+func ConvertDitherFlag(dither *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.dither = *dither
+	}
+}
+
+func ConvertPaletteSize(paletteSize int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteSize = paletteSize
+	}
+}
+func ConvertPaletteSizeFlag(paletteSize *int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteSize = *paletteSize
+	}
+}
+
+func ConvertPaletteMethod(paletteMethod string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteMethod = paletteMethod
+	}
+}
+func ConvertPaletteMethodFlag(paletteMethod *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.paletteMethod = *paletteMethod
+	}
+}
+
+func ConvertGameboyGreen(gameboyGreen bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.gameboyGreen = gameboyGreen
+	}
+}
+func ConvertGameboyGreenFlag(gameboyGreen *bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.gameboyGreen = *gameboyGreen
+	}
+}
+
+func ConvertZxScr(zxScr bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.zxScr = zxScr
+	}
+}
+func ConvertZxScrFlag(zxScr *bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.zxScr = *zxScr
+	}
+}
+
+func ConvertTileset(tileset bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.tileset = tileset
+	}
+}
+func ConvertTilesetFlag(tileset *bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.tileset = *tileset
+	}
+}
+
+func ConvertTileSize(tileSize int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.tileSize = tileSize
+	}
+}
+func ConvertTileSizeFlag(tileSize *int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.tileSize = *tileSize
+	}
+}
+
+func ConvertTextMedian(textMedian bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.textMedian = textMedian
+	}
+}
+func ConvertTextMedianFlag(textMedian *bool) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.textMedian = *textMedian
+	}
+}
+
+func ConvertResultJSON(resultJSON string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.resultJSON = resultJSON
+	}
+}
+func ConvertResultJSONFlag(resultJSON *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.resultJSON = *resultJSON
+	}
+}
+
+func ConvertJobs(jobs int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.jobs = jobs
+	}
+}
+func ConvertJobsFlag(jobs *int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.jobs = *jobs
+	}
+}
+
+func ConvertThreads(threads int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.threads = threads
+	}
+}
+func ConvertThreadsFlag(threads *int) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.threads = *threads
+	}
+}
+
+func ConvertColorSpace(colorSpace string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.colorSpace = colorSpace
+	}
+}
+func ConvertColorSpaceFlag(colorSpace *string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.colorSpace = *colorSpace
+	}
+}
+
+func ConvertOverwrite(overwrite []string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.overwrite = overwrite
+	}
+}
+func ConvertOverwriteFlag(overwrite *[]string) ConvertOption {
+	return func(opts *convertOptionImpl) {
+		opts.overwrite = *overwrite
+	}
+}
+
 type convertOptionImpl struct {
 	blockSize             int
 	animateBlockSizeRange blockSizeRange
@@ -177,6 +369,22 @@ type convertOptionImpl struct {
 	colorHist             bool
 	animateThreads        int
 	animateReverse        bool
+	pixelateResolution    uint
+	palette               string
+	paletteFile           string
+	dither                string
+	paletteSize           int
+	paletteMethod         string
+	gameboyGreen          bool
+	zxScr                 bool
+	tileset               bool
+	tileSize              int
+	textMedian            bool
+	resultJSON            string
+	jobs                  int
+	threads               int
+	colorSpace            string
+	overwrite             []string
 }
 
 func (c *convertOptionImpl) BlockSize() int                        { return c.blockSize }
@@ -192,6 +400,22 @@ func (c *convertOptionImpl) OutputFile() string                    { return c.ou
 func (c *convertOptionImpl) ColorHist() bool                       { return c.colorHist }
 func (c *convertOptionImpl) AnimateThreads() int                   { return c.animateThreads }
 func (c *convertOptionImpl) AnimateReverse() bool                  { return c.animateReverse }
+func (c *convertOptionImpl) PixelateResolution() uint              { return c.pixelateResolution }
+func (c *convertOptionImpl) Palette() string                       { return c.palette }
+func (c *convertOptionImpl) PaletteFile() string                   { return c.paletteFile }
+func (c *convertOptionImpl) Dither() string                        { return c.dither }
+func (c *convertOptionImpl) PaletteSize() int                      { return c.paletteSize }
+func (c *convertOptionImpl) PaletteMethod() string                 { return c.paletteMethod }
+func (c *convertOptionImpl) GameboyGreen() bool                    { return c.gameboyGreen }
+func (c *convertOptionImpl) ZxScr() bool                           { return c.zxScr }
+func (c *convertOptionImpl) Tileset() bool                         { return c.tileset }
+func (c *convertOptionImpl) TileSize() int                         { return c.tileSize }
+func (c *convertOptionImpl) TextMedian() bool                      { return c.textMedian }
+func (c *convertOptionImpl) ResultJSON() string                    { return c.resultJSON }
+func (c *convertOptionImpl) Jobs() int                             { return c.jobs }
+func (c *convertOptionImpl) Threads() int                          { return c.threads }
+func (c *convertOptionImpl) ColorSpace() string                    { return c.colorSpace }
+func (c *convertOptionImpl) Overwrite() []string                   { return c.overwrite }
 
 func makeConvertOptionImpl(opts ...ConvertOption) *convertOptionImpl {
 	res := &convertOptionImpl{}
@@ -0,0 +1,208 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+const (
+	gameboyWidth    = 160
+	gameboyHeight   = 144
+	gameboyTileSize = 8
+	// Tiles that fit in the 6KB of DMG VRAM tile data.
+	gameboyMaxTiles = 384
+)
+
+// gameboyScreen is an image of 4 shades, numbered like the DMG does: 0 is
+// the lightest and 3 the darkest.
+type gameboyScreen struct {
+	// In pixels, multiples of gameboyTileSize.
+	width, height int
+	// Per pixel, row-major.
+	shades []uint8
+}
+
+var gameboyGrays = color.Palette{
+	color.Gray{0xFF},
+	color.Gray{0xAA},
+	color.Gray{0x55},
+	color.Gray{0x00},
+}
+
+// gameboyRamp returns the colors of the 4 shades, lightest first.
+func gameboyRamp(opts ConvertOptions) color.Palette {
+	if !opts.GameboyGreen() {
+		return gameboyGrays
+	}
+	dmg, _ := palette.Get("gameboy_dmg")
+	var res color.Palette
+	for i := len(dmg.Colors) - 1; i >= 0; i-- {
+		res = append(res, dmg.Colors[i])
+	}
+	return res
+}
+
+// gameboySize is 160x144 unless ResizeWidth and ResizeHeight are given, in
+// which case those are used, rounded down to whole tiles.
+func gameboySize(opts ConvertOptions) (int, int) {
+	if opts.ResizeWidth() == 0 || opts.ResizeHeight() == 0 {
+		return gameboyWidth, gameboyHeight
+	}
+	round := func(n uint) int {
+		return intgr.Max(gameboyTileSize, int(n)/gameboyTileSize*gameboyTileSize)
+	}
+	return round(opts.ResizeWidth()), round(opts.ResizeHeight())
+}
+
+// coverAndCrop scales img so it covers width x height, keeping the aspect
+// ratio, and crops the center.
+func coverAndCrop(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	scaledWidth, scaledHeight := width, b.Dy()*width/b.Dx()
+	if scaledHeight < height {
+		scaledWidth, scaledHeight = b.Dx()*height/b.Dy(), height
+	}
+	scaled := resize.Resize(uint(scaledWidth), uint(scaledHeight), img, resize.Lanczos3)
+	x, y := (scaledWidth-width)/2, (scaledHeight-height)/2
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	for yy := 0; yy < height; yy++ {
+		for xx := 0; xx < width; xx++ {
+			res.Set(xx, yy, scaled.At(scaled.Bounds().Min.X+x+xx, scaled.Bounds().Min.Y+y+yy))
+		}
+	}
+	return res
+}
+
+func makeGameboyScreen(inputImage image.Image, opts ConvertOptions) (*gameboyScreen, error) {
+	width, height := gameboySize(opts)
+	cropped := coverAndCrop(inputImage, width, height)
+	gray := image.NewGray(cropped.Bounds())
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			gray.Set(x, y, cropped.At(x, y))
+		}
+	}
+	shaded, err := palette.ApplyDitheredIn(gray, gameboyGrays, palette.Dither(opts.Dither()), paletteSpace(opts))
+	if err != nil {
+		return nil, err
+	}
+	return &gameboyScreen{width: width, height: height, shades: shaded.Pix}, nil
+}
+
+// tile returns the shades of the 8x8 tile at tile column tx and row ty.
+func (s *gameboyScreen) tile(tx, ty int) [gameboyTileSize * gameboyTileSize]uint8 {
+	var res [gameboyTileSize * gameboyTileSize]uint8
+	for y := 0; y < gameboyTileSize; y++ {
+		for x := 0; x < gameboyTileSize; x++ {
+			res[y*gameboyTileSize+x] = s.shades[(ty*gameboyTileSize+y)*s.width+tx*gameboyTileSize+x]
+		}
+	}
+	return res
+}
+
+// uniqueTiles returns the distinct tiles in the order they first appear.
+func (s *gameboyScreen) uniqueTiles() [][gameboyTileSize * gameboyTileSize]uint8 {
+	var res [][gameboyTileSize * gameboyTileSize]uint8
+	seen := map[[gameboyTileSize * gameboyTileSize]uint8]bool{}
+	for ty := 0; ty < s.height/gameboyTileSize; ty++ {
+		for tx := 0; tx < s.width/gameboyTileSize; tx++ {
+			if t := s.tile(tx, ty); !seen[t] {
+				seen[t] = true
+				res = append(res, t)
+			}
+		}
+	}
+	return res
+}
+
+// native returns the unique tiles in the 2bpp format of the Game Boy and,
+// if they can all be addressed by a background map, the map of 1 byte per tile.
+func (s *gameboyScreen) native() (map[string][]byte, error) {
+	tiles := s.uniqueTiles()
+	if len(tiles) > gameboyMaxTiles {
+		return nil, errors.Errorf("%d unique tiles don't fit in the %d of VRAM", len(tiles), gameboyMaxTiles)
+	}
+
+	// Each row of a tile is a byte of the low bits of its pixels followed by
+	// a byte of the high bits.
+	var data []byte
+	index := map[[gameboyTileSize * gameboyTileSize]uint8]int{}
+	for i, t := range tiles {
+		index[t] = i
+		for y := 0; y < gameboyTileSize; y++ {
+			var lo, hi byte
+			for x := 0; x < gameboyTileSize; x++ {
+				v := t[y*gameboyTileSize+x]
+				lo = lo<<1 | v&1
+				hi = hi<<1 | v>>1
+			}
+			data = append(data, lo, hi)
+		}
+	}
+	res := map[string][]byte{".2bpp": data}
+
+	if len(tiles) > 256 {
+		log.Printf("gameboy: not writing a tilemap since %d unique tiles can't be addressed by one byte", len(tiles))
+		return res, nil
+	}
+	var tilemap []byte
+	for ty := 0; ty < s.height/gameboyTileSize; ty++ {
+		for tx := 0; tx < s.width/gameboyTileSize; tx++ {
+			tilemap = append(tilemap, byte(index[s.tile(tx, ty)]))
+		}
+	}
+	res[".tilemap"] = tilemap
+	return res, nil
+}
+
+func (s *gameboyScreen) nativeFormats() map[string]nativeEncoder {
+	return map[string]nativeEncoder{".2bpp": s.native}
+}
+
+func gameboyConvert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	s, err := makeGameboyScreen(inputImage, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	numTiles := (s.width / gameboyTileSize) * (s.height / gameboyTileSize)
+	numUnique := len(s.uniqueTiles())
+	if numUnique > gameboyMaxTiles {
+		log.Printf("gameboy: %dx%d needs %d unique tiles of %d, more than the %d that fit in VRAM", s.width, s.height, numUnique, numTiles, gameboyMaxTiles)
+	} else {
+		log.Printf("gameboy: %dx%d needs %d unique tiles of %d, %d fit in VRAM", s.width, s.height, numUnique, numTiles, gameboyMaxTiles)
+	}
+
+	ramp := gameboyRamp(opts)
+	outputImage := image.NewPaletted(image.Rect(0, 0, s.width, s.height), ramp)
+	copy(outputImage.Pix, s.shades)
+	res := makeNativeConvertResult(outputImage, s, nil)
+	return res, nil
+}
+
+type gameboyConverter struct{ baseConverter }
+
+func (c *gameboyConverter) OutputFileName(input string, opts ConvertOptions) string {
+	ext := path.Ext(input)
+	base := strings.Replace(path.Base(input), ext, "", 1)
+	width, height := gameboySize(opts)
+	return fmt.Sprintf("%s-%s-%dx%d%s", base, c.Name(), width, height, ext)
+}
+
+func (c *gameboyConverter) sizesOutput() bool { return true }
+
+func init() {
+	globalReg.Register(&gameboyConverter{
+		baseConverter{
+			name: "gameboy",
+			conv: gameboyConvert,
+		}})
+}
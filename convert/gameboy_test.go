@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGameboyScreen(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 300, 200))
+	s, err := makeGameboyScreen(img, MakeConvertOptions())
+	if err != nil {
+		t.Fatalf("makeGameboyScreen: %v", err)
+	}
+	if s.width != gameboyWidth || s.height != gameboyHeight {
+		t.Errorf("size = %dx%d, want %dx%d", s.width, s.height, gameboyWidth, gameboyHeight)
+	}
+	if got := len(s.uniqueTiles()); got != 1 {
+		t.Errorf("unique tiles = %d, want 1", got)
+	}
+	for i, shade := range s.shades {
+		if shade != 3 {
+			t.Fatalf("shade of black pixel %d = %d, want 3", i, shade)
+		}
+	}
+}
+
+func TestGameboySizeHonorsResize(t *testing.T) {
+	w, h := gameboySize(MakeConvertOptions(ConvertResizeWidth(330), ConvertResizeHeight(290)))
+	if w != 328 || h != 288 {
+		t.Errorf("gameboySize = %dx%d, want 328x288", w, h)
+	}
+}
+
+func TestGameboyNativeMatchesScreen(t *testing.T) {
+	s, err := makeGameboyScreen(randomImage(40, 36, 6), MakeConvertOptions(ConvertResizeWidth(32), ConvertResizeHeight(16)))
+	if err != nil {
+		t.Fatalf("makeGameboyScreen: %v", err)
+	}
+	files, err := s.native()
+	if err != nil {
+		t.Fatalf("native: %v", err)
+	}
+	data, tilemap := files[".2bpp"], files[".tilemap"]
+	if len(tilemap) != 8 {
+		t.Fatalf("len(tilemap) = %d, want 8", len(tilemap))
+	}
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			tile := int(tilemap[(y/8)*4+x/8])
+			lo, hi := data[16*tile+2*(y%8)], data[16*tile+2*(y%8)+1]
+			bit := 7 - x%8
+			if got, want := (lo>>bit)&1|((hi>>bit)&1)<<1, s.shades[y*s.width+x]; got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestGameboyResizeKeepsShades(t *testing.T) {
+	// A gradient, so all the shades are used.
+	gradient := image.NewGray(image.Rect(0, 0, 200, 180))
+	for y := 0; y < 180; y++ {
+		for x := 0; x < 200; x++ {
+			gradient.SetGray(x, y, color.Gray{uint8(x * 255 / 199)})
+		}
+	}
+	for _, converter := range []string{"gameboy", "block_mean|gameboy"} {
+		res, err := ConvertImage(gradient, converter, ConvertResizeWidth(100), ConvertResizeHeight(90))
+		if err != nil {
+			t.Fatalf("%s: ConvertImage: %v", converter, err)
+		}
+		img := res.Image()
+		if b := img.Bounds(); b.Dx() != 96 || b.Dy() != 88 {
+			t.Errorf("%s: size = %dx%d, want 96x88", converter, b.Dx(), b.Dy())
+		}
+		colors := map[color.Color]bool{}
+		for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+			for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+				colors[img.At(x, y)] = true
+			}
+		}
+		if len(colors) != 4 {
+			t.Errorf("%s: %d colors, want 4", converter, len(colors))
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+const (
+	nesTileSize      = 8
+	nesAreaSize      = 16
+	nesNumSubPalette = 4
+	// A nametable is 32x30 tiles and a pattern table holds 256 of them.
+	nesNametableWidth  = 32
+	nesNametableHeight = 30
+	nesMaxTiles        = 256
+)
+
+// nesScreen is an image that follows the rules of the NES PPU background:
+// every 16x16 attribute area uses one of 4 sub-palettes, each of which is 3
+// colors plus a background color shared by all of them.
+type nesScreen struct {
+	// In pixels, multiples of nesAreaSize.
+	width, height int
+	// NES color numbers, i.e. indices into the "nes" palette.
+	background  uint8
+	subPalettes [nesNumSubPalette][3]uint8
+	// Sub-palette of each attribute area, row-major.
+	areas []uint8
+	// Per pixel, row-major: 0 for the background or 1-3 for a color of the
+	// sub-palette of the pixel's area.
+	pixels []uint8
+}
+
+func (s *nesScreen) areaAt(x, y int) uint8 {
+	return s.areas[(y/nesAreaSize)*(s.width/nesAreaSize)+x/nesAreaSize]
+}
+
+// colorIndexAt returns the NES color number of the pixel at (x, y).
+func (s *nesScreen) colorIndexAt(x, y int) uint8 {
+	v := s.pixels[y*s.width+x]
+	if v == 0 {
+		return s.background
+	}
+	return s.subPalettes[s.areaAt(x, y)][v-1]
+}
+
+// nesColors are the NES color numbers worth using: the duplicate blacks are
+// dropped in favor of $0F, the conventional black.
+func nesColors() []uint8 {
+	var res []uint8
+	for i := 0; i < 64; i++ {
+		if lo := i & 0x0F; lo <= 0x0C || i == 0x0F || i == 0x2D || i == 0x3D {
+			res = append(res, uint8(i))
+		}
+	}
+	return res
+}
+
+func makeNESScreen(inputImage image.Image, opts ConvertOptions) *nesScreen {
+	nes, _ := palette.Get("nes")
+	usable := nesColors()
+	var usablePalette color.Palette
+	for _, c := range usable {
+		usablePalette = append(usablePalette, nes.Colors[c])
+	}
+	space := colorSpaceOf(opts)
+	var dist [64][64]float64
+	for i := range dist {
+		for j := range dist[i] {
+			dist[i][j] = sqDiffIn(space, nes.Colors[i], nes.Colors[j])
+		}
+	}
+
+	// Each NES pixel is a block of the input, snapped to the nearest NES color
+	// and padded to whole attribute areas by repeating the edges.
+	blocks := blockColors(inputImage, opts.BlockSize(), medianAggr(opts), opts.Threads())
+	rows, cols := len(blocks), len(blocks[0])
+	s := &nesScreen{
+		width:  roundUp(cols, nesAreaSize),
+		height: roundUp(rows, nesAreaSize),
+	}
+	snapped := make([]uint8, s.width*s.height)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			c := blocks[intgr.Min(y, rows-1)][intgr.Min(x, cols-1)]
+			snapped[y*s.width+x] = usable[nearestIn(space, c, usablePalette)]
+		}
+	}
+
+	// The most common color is the background.
+	var counts [64]int
+	for _, c := range snapped {
+		counts[c]++
+	}
+	s.background = mostCommon(counts[:], nil)[0]
+
+	areasWide, areasHigh := s.width/nesAreaSize, s.height/nesAreaSize
+	areaCounts := make([][64]int, areasWide*areasHigh)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			areaCounts[(y/nesAreaSize)*areasWide+x/nesAreaSize][snapped[y*s.width+x]]++
+		}
+	}
+
+	subPaletteOf := func(counts []int) [3]uint8 {
+		var sub [3]uint8
+		top := mostCommon(counts, func(c uint8) bool { return c != s.background })
+		for i := range sub {
+			if i < len(top) {
+				sub[i] = top[i]
+			} else {
+				sub[i] = s.background
+			}
+		}
+		return sub
+	}
+	areaError := func(counts [64]int, sub [3]uint8) float64 {
+		var res float64
+		for c, n := range counts {
+			if n == 0 {
+				continue
+			}
+			best := dist[c][s.background]
+			for _, sc := range sub {
+				if d := dist[c][sc]; d < best {
+					best = d
+				}
+			}
+			res += float64(n) * best
+		}
+		return res
+	}
+	bestSubPalette := func(counts [64]int, numSubs int) (int, float64) {
+		best, bestErr := 0, -1.0
+		for i := 0; i < numSubs; i++ {
+			if err := areaError(counts, s.subPalettes[i]); bestErr < 0 || err < bestErr {
+				best, bestErr = i, err
+			}
+		}
+		return best, bestErr
+	}
+
+	// Seed the sub-palettes farthest-first: start with the most common colors
+	// and then add the colors of the area that's worst served so far.
+	s.subPalettes[0] = subPaletteOf(counts[:])
+	for i := 1; i < nesNumSubPalette; i++ {
+		worst, worstErr := 0, -1.0
+		for a, ac := range areaCounts {
+			if _, err := bestSubPalette(ac, i); err > worstErr {
+				worst, worstErr = a, err
+			}
+		}
+		s.subPalettes[i] = subPaletteOf(areaCounts[worst][:])
+	}
+
+	// Then alternate between assigning areas to sub-palettes and picking
+	// each sub-palette from its areas.
+	s.areas = make([]uint8, len(areaCounts))
+	for iter := 0; iter < 8; iter++ {
+		changed := false
+		for a, ac := range areaCounts {
+			best, _ := bestSubPalette(ac, nesNumSubPalette)
+			if uint8(best) != s.areas[a] || iter == 0 {
+				s.areas[a] = uint8(best)
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		for i := range s.subPalettes {
+			var merged [64]int
+			for a, ac := range areaCounts {
+				if s.areas[a] != uint8(i) {
+					continue
+				}
+				for c, n := range ac {
+					merged[c] += n
+				}
+			}
+			if sub := subPaletteOf(merged[:]); sub != [3]uint8{s.background, s.background, s.background} {
+				s.subPalettes[i] = sub
+			}
+		}
+	}
+
+	s.pixels = make([]uint8, s.width*s.height)
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			c, sub := snapped[y*s.width+x], s.subPalettes[s.areaAt(x, y)]
+			best, bestDist := uint8(0), dist[c][s.background]
+			for i, sc := range sub {
+				if d := dist[c][sc]; d < bestDist {
+					best, bestDist = uint8(i+1), d
+				}
+			}
+			s.pixels[y*s.width+x] = best
+		}
+	}
+
+	return s
+}
+
+type nesTile [nesTileSize * nesTileSize]uint8
+
+// tiles returns the distinct tiles of the screen, starting with a tile of
+// only the background, and the index of each tile of the screen, row-major.
+func (s *nesScreen) tiles() ([]nesTile, []int) {
+	tiles := []nesTile{{}}
+	seen := map[nesTile]int{{}: 0}
+	var indices []int
+	for ty := 0; ty < s.height/nesTileSize; ty++ {
+		for tx := 0; tx < s.width/nesTileSize; tx++ {
+			var t nesTile
+			for y := 0; y < nesTileSize; y++ {
+				for x := 0; x < nesTileSize; x++ {
+					t[y*nesTileSize+x] = s.pixels[(ty*nesTileSize+y)*s.width+tx*nesTileSize+x]
+				}
+			}
+			i, ok := seen[t]
+			if !ok {
+				i = len(tiles)
+				seen[t] = i
+				tiles = append(tiles, t)
+			}
+			indices = append(indices, i)
+		}
+	}
+	return tiles, indices
+}
+
+// native returns a 4KB pattern table (CHR), a 1KB nametable with its
+// attribute table and the 16 bytes of background palette.
+func (s *nesScreen) native() (map[string][]byte, error) {
+	if s.width > nesNametableWidth*nesTileSize || s.height > nesNametableHeight*nesTileSize {
+		return nil, errors.Errorf("%dx%d is larger than a %dx%d nametable; use a larger block size",
+			s.width, s.height, nesNametableWidth*nesTileSize, nesNametableHeight*nesTileSize)
+	}
+	tiles, indices := s.tiles()
+	if len(tiles) > nesMaxTiles {
+		return nil, errors.Errorf("%d unique tiles don't fit in the %d of a pattern table; use a larger block size", len(tiles), nesMaxTiles)
+	}
+
+	// Each tile is 8 bytes of the low bits of its pixels followed by 8 of the high bits.
+	chr := make([]byte, nesMaxTiles*16)
+	for i, t := range tiles {
+		for y := 0; y < nesTileSize; y++ {
+			var lo, hi byte
+			for x := 0; x < nesTileSize; x++ {
+				v := t[y*nesTileSize+x]
+				lo = lo<<1 | v&1
+				hi = hi<<1 | v>>1
+			}
+			chr[16*i+y] = lo
+			chr[16*i+8+y] = hi
+		}
+	}
+
+	tilesWide := s.width / nesTileSize
+	nam := make([]byte, 1024)
+	for i, t := range indices {
+		nam[(i/tilesWide)*nesNametableWidth+i%tilesWide] = byte(t)
+	}
+	// Each attribute byte covers 2x2 areas: top left in bits 0-1, top right
+	// in 2-3, bottom left in 4-5 and bottom right in 6-7.
+	const attrs = nesNametableWidth * nesNametableHeight
+	for y := 0; y < s.height; y += nesAreaSize {
+		for x := 0; x < s.width; x += nesAreaSize {
+			shift := ((y/nesAreaSize)%2)*4 + ((x/nesAreaSize)%2)*2
+			nam[attrs+(y/32)*8+x/32] |= s.areaAt(x, y) << shift
+		}
+	}
+
+	pal := make([]byte, 4*nesNumSubPalette)
+	for i, sub := range s.subPalettes {
+		pal[4*i] = s.background
+		copy(pal[4*i+1:], sub[:])
+	}
+
+	return map[string][]byte{".chr": chr, ".nam": nam, ".pal": pal}, nil
+}
+
+func (s *nesScreen) nativeFormats() map[string]nativeEncoder {
+	return map[string]nativeEncoder{".chr": s.native}
+}
+
+// mostCommon returns the indices of counts with non-zero counts from most to
+// least common, ties broken by the lower index, skipping those keep rejects.
+func mostCommon(counts []int, keep func(uint8) bool) []uint8 {
+	var res []uint8
+	for i, n := range counts {
+		if n > 0 && (keep == nil || keep(uint8(i))) {
+			res = append(res, uint8(i))
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return counts[res[i]] > counts[res[j]] })
+	return res
+}
+
+func nesConvert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	if inputImage.Bounds().Empty() {
+		return nil, errors.Errorf("cannot convert an empty %v image to the NES", inputImage.Bounds())
+	}
+	s := makeNESScreen(inputImage, opts)
+	nes, _ := palette.Get("nes")
+	outputImage := renderBlocks(inputImage.Bounds(), opts.BlockSize(), func(row, col int) color.Color {
+		return nes.Colors[s.colorIndexAt(col, row)]
+	})
+	res := makeNativeConvertResult(outputImage, s, nil)
+	return res, nil
+}
+
+func init() {
+	globalReg.Register(&overlapConverter{
+		baseConverter{
+			name: "nes",
+			conv: nesConvert,
+		}})
+}
@@ -0,0 +1,146 @@
+package convert
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/spudtrooper/goutil/io"
+)
+
+func randomImage(w, h int, seed int64) image.Image {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(r.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+func TestNESAttributeAreas(t *testing.T) {
+	opts := MakeConvertOptions(ConvertBlockSize(2))
+	s := makeNESScreen(randomImage(100, 70, 1), opts)
+	if s.width%nesAreaSize != 0 || s.height%nesAreaSize != 0 {
+		t.Fatalf("size %dx%d is not whole attribute areas", s.width, s.height)
+	}
+	for ay := 0; ay < s.height; ay += nesAreaSize {
+		for ax := 0; ax < s.width; ax += nesAreaSize {
+			allowed := map[uint8]bool{s.background: true}
+			for _, c := range s.subPalettes[s.areaAt(ax, ay)] {
+				allowed[c] = true
+			}
+			for y := ay; y < ay+nesAreaSize; y++ {
+				for x := ax; x < ax+nesAreaSize; x++ {
+					if c := s.colorIndexAt(x, y); !allowed[c] {
+						t.Fatalf("color $%02X at (%d,%d) isn't the background or in the area's sub-palette", c, x, y)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestNESConvertKeepsSize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 37, 23))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	res, err := nesConvert("", img, MakeConvertOptions(ConvertBlockSize(3)))
+	if err != nil {
+		t.Fatalf("nesConvert: %v", err)
+	}
+	if got, want := res.Image().Bounds(), img.Bounds(); got != want {
+		t.Errorf("bounds = %v, want %v", got, want)
+	}
+	if got := color.RGBAModel.Convert(res.Image().At(0, 0)).(color.RGBA); got.R < 0xF0 || got.G < 0xF0 || got.B < 0xF0 {
+		t.Errorf("white became %v", got)
+	}
+}
+
+func TestNESNativeMatchesScreen(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 4), G: uint8(y * 5), B: uint8((x / 8) * 30), A: 255})
+		}
+	}
+	s := makeNESScreen(img, MakeConvertOptions(ConvertBlockSize(1)))
+	files, err := s.native()
+	if err != nil {
+		t.Fatalf("native: %v", err)
+	}
+	chr, nam, pal := files[".chr"], files[".nam"], files[".pal"]
+	if len(chr) != 4096 || len(nam) != 1024 || len(pal) != 16 {
+		t.Fatalf("sizes = %d, %d, %d, want 4096, 1024, 16", len(chr), len(nam), len(pal))
+	}
+	for y := 0; y < s.height; y++ {
+		for x := 0; x < s.width; x++ {
+			tile := int(nam[(y/8)*32+x/8])
+			row := y % 8
+			bit := 7 - x%8
+			v := (chr[16*tile+row]>>bit)&1 | ((chr[16*tile+8+row]>>bit)&1)<<1
+			attr := nam[960+(y/32)*8+x/32]
+			sub := attr >> (((y/16)%2)*4 + ((x/16)%2)*2) & 3
+			if got, want := pal[4*int(sub)+int(v)], s.colorIndexAt(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = $%02X, want $%02X", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestNESNativeCompanionFilesNeedForce(t *testing.T) {
+	dir := t.TempDir()
+	input, output := path.Join(dir, "in.png"), path.Join(dir, "out.chr")
+	writeTestPNG(t, input, 1)
+	pal := path.Join(dir, "out.pal")
+	if err := os.WriteFile(pal, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cOpts := []ConvertOption{ConvertConverters([]string{"nes"}), ConvertBlockSize(1), ConvertOutputFile(output)}
+	if _, err := Convert(input, cOpts...); err == nil || !strings.Contains(err.Error(), pal) {
+		t.Errorf("err = %v, want one about %s", err, pal)
+	}
+	if io.FileExists(output) {
+		t.Errorf("%s was written", output)
+	}
+	if b, _ := os.ReadFile(pal); string(b) != "keep" {
+		t.Errorf("%s was overwritten", pal)
+	}
+
+	if _, err := Convert(input, append(cOpts, ConvertForce(true))...); err != nil {
+		t.Fatalf("Convert with force: %v", err)
+	}
+	if b, _ := os.ReadFile(pal); len(b) != 16 {
+		t.Errorf("len(%s) = %d, want 16", pal, len(b))
+	}
+}
+
+func TestNESPaletteDropsNative(t *testing.T) {
+	res, err := ConvertImage(randomImage(16, 16, 2), "nes", ConvertBlockSize(1), ConvertPalette("gameboy_dmg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nativeOf(res) != nil {
+		t.Errorf("native screen kept after reducing to another palette")
+	}
+	if err := Encode(&bytes.Buffer{}, ".chr", res); err == nil {
+		t.Errorf("Encode of .chr succeeded")
+	}
+}
+
+func TestNESEmptyImage(t *testing.T) {
+	for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 16, 0), image.Rect(0, 0, 0, 16)} {
+		if _, err := ConvertImage(image.NewRGBA(r), "nes"); err == nil {
+			t.Errorf("ConvertImage of %v succeeded", r)
+		}
+	}
+}
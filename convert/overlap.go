@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"image"
 	"image/color"
+	"math"
 	"math/rand"
 	"path"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/spudtrooper/goutil/hist"
 	"github.com/spudtrooper/goutil/or"
@@ -16,63 +19,161 @@ import (
 
 type colorAggrFn func(inputImage image.Image, startY, endY, startX, endX int) color.Color
 
+// overlap aggregates the 2*blockSize square around each corner of the grid of
+// blockSize blocks of inputImage into one color. The squares overlap and later
+// ones, in row-major order, cover earlier ones. Rows of blocks are split into
+// bands done by Threads goroutines.
 func overlap(input string, inputImage image.Image, blockSize int, opts ConvertOptions, aggr colorAggrFn, random bool) (ConvertResult, error) {
 	minY, maxY := inputImage.Bounds().Min.Y, inputImage.Bounds().Max.Y
 	minX, maxX := inputImage.Bounds().Min.X, inputImage.Bounds().Max.X
 
 	outputImage := image.NewRGBA(image.Rect(minX, minY, maxX, maxY))
 
+	inputImage = fastPixels(inputImage)
 	inc := or.Int(blockSize, 10)
+	rows := (maxY - minY + inc - 1) / inc
+	cols := (maxX - minX + inc - 1) / inc
 
-	colorHist := hist.MakeHistogram()
+	// colors[r][c] is the color of the square around (minX+c*inc, minY+r*inc).
+	colors := make([][]color.Color, rows)
+	forBands(rows, opts.Threads(), func(start, end int) {
+		for r := start; r < end; r++ {
+			y := minY + r*inc
+			row := make([]color.Color, cols)
+			for c := range row {
+				x := minX + c*inc
+				row[c] = aggr(inputImage, intgr.Max(y-inc, minY), intgr.Min(y+inc, maxY), intgr.Max(x-inc, minX), intgr.Min(x+inc, maxX))
+			}
+			colors[r] = row
+		}
+	})
 
-	for y := minY; y < maxY; y += inc {
-		for x := minX; x < maxX; x += inc {
-			startY := intgr.Max(y-inc, minY)
-			endY := intgr.Min(y+inc, maxY)
-			startX := intgr.Max(x-inc, minX)
-			endX := intgr.Min(x+inc, maxX)
-			mc := aggr(inputImage, startY, endY, startX, endX)
-			colorHist.Add(colorName(mc), 1)
-			mr, mg, mb, ma := mc.RGBA()
-			for y := startY; y < endY; y++ {
-				for x := startX; x < endX; x++ {
-					var c color.Color
-					if random {
-						c = color.RGBA{
-							R: uint8(mr + uint32(30-rand.Int()%60)),
-							G: uint8(mg + uint32(30-rand.Int()%60)),
-							B: uint8(mb + uint32(30-rand.Int()%60)),
-							A: uint8(ma + uint32(30-rand.Int()%60)),
-						}
-					} else {
-						c = color.RGBA{
-							R: uint8(mr),
-							G: uint8(mg),
-							B: uint8(mb),
-							A: uint8(ma),
-						}
-					}
-					outputImage.Set(x, y, c)
+	// Each pixel ends up with the color of the last square covering it, which
+	// is the one around the next corner down and right, so the bands write
+	// disjoint pixels and match drawing the squares in order.
+	lastCovering := func(d, n int) int { return intgr.Min(d/inc+1, n-1) }
+	forBands(rows, opts.Threads(), func(start, end int) {
+		rnd := rand.New(rand.NewSource(rand.Int63()))
+		// The colors of the row of squares covering y.
+		rowColors, rowColorsRow := make([]color.RGBA, cols), -1
+		for y := minY + start*inc; y < intgr.Min(minY+end*inc, maxY); y++ {
+			if r := lastCovering(y-minY, rows); r != rowColorsRow {
+				rowColorsRow = r
+				for c, mc := range colors[r] {
+					rowColors[c] = rgba8(mc.RGBA())
 				}
 			}
+			for x := minX; x < maxX; x++ {
+				c := rowColors[lastCovering(x-minX, cols)]
+				if random {
+					c = jitter(c, rnd)
+				}
+				outputImage.SetRGBA(x, y, c)
+			}
 		}
-	}
+	})
 
+	colorHist := hist.MakeHistogram()
+	colorCounts := map[string]int{}
+	for _, row := range colors {
+		for _, mc := range row {
+			colorHist.Add(colorName(mc), 1)
+			colorCounts[colorHex(mc)]++
+		}
+	}
 	if opts.ColorHist() {
 		log.Println("Printing color histogram...\n" + hist.HistString(colorHist))
 	}
 
-	res := makeImageConvertResult(outputImage)
+	var blocks *BlockGrid
+	if !random {
+		blocks = sampleBlocks(outputImage, inc)
+	}
+	res := makeBlocksConvertResult(outputImage, blocks, colorCounts)
 	return res, nil
 }
 
+// jitter moves each of the color channels of c by up to 30 either way, keeping
+// alpha and clamping the channels to it as c is premultiplied.
+func jitter(c color.RGBA, rnd *rand.Rand) color.RGBA {
+	return color.RGBA{
+		R: clamp8(int(c.R)+30-rnd.Intn(60), c.A),
+		G: clamp8(int(c.G)+30-rnd.Intn(60), c.A),
+		B: clamp8(int(c.B)+30-rnd.Intn(60), c.A),
+		A: c.A,
+	}
+}
+
+// forBands calls f on contiguous bands [start, end) covering [0, n) from up
+// to threads goroutines, defaulting to one per CPU, and waits for them.
+func forBands(n, threads int, f func(start, end int)) {
+	threads = intgr.Max(1, intgr.Min(or.Int(threads, runtime.NumCPU()), n))
+	var wg sync.WaitGroup
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			f(start, end)
+		}(i*n/threads, (i+1)*n/threads)
+	}
+	wg.Wait()
+}
+
+// blockColors aggregates each non-overlapping blockSize x blockSize block of
+// inputImage into a single color, returning the grid indexed by [row][col].
+// The rows are split across threads goroutines.
+func blockColors(inputImage image.Image, blockSize int, aggr colorAggrFn, threads int) [][]color.Color {
+	inc := or.Int(blockSize, 10)
+	return rectBlockColors(inputImage, inc, inc, aggr, threads)
+}
+
+// rectBlockColors is blockColors for blocks of blockWidth x blockHeight.
+func rectBlockColors(inputImage image.Image, blockWidth, blockHeight int, aggr colorAggrFn, threads int) [][]color.Color {
+	minY, maxY := inputImage.Bounds().Min.Y, inputImage.Bounds().Max.Y
+	minX, maxX := inputImage.Bounds().Min.X, inputImage.Bounds().Max.X
+
+	inputImage = fastPixels(inputImage)
+	rows := (maxY - minY + blockHeight - 1) / blockHeight
+	res := make([][]color.Color, rows)
+	forBands(rows, threads, func(start, end int) {
+		for r := start; r < end; r++ {
+			y := minY + r*blockHeight
+			var row []color.Color
+			for x := minX; x < maxX; x += blockWidth {
+				row = append(row, aggr(inputImage, y, intgr.Min(y+blockHeight, maxY), x, intgr.Min(x+blockWidth, maxX)))
+			}
+			res[r] = row
+		}
+	})
+	return res
+}
+
+// renderBlocks draws the grid of blocks returned by colorAt, indexed by row
+// and column, onto an image with bounds, clipping blocks at the edges.
+func renderBlocks(bounds image.Rectangle, blockSize int, colorAt func(row, col int) color.Color) *image.RGBA {
+	outputImage := image.NewRGBA(bounds)
+	inc := or.Int(blockSize, 10)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			outputImage.Set(x, y, colorAt((y-bounds.Min.Y)/inc, (x-bounds.Min.X)/inc))
+		}
+	}
+	return outputImage
+}
+
+// The aggregators work on the alpha-premultiplied 16-bit components returned
+// by color.Color.RGBA and return the result scaled down to a color.RGBA.
+
 func medianColor(inputImage image.Image, startY, endY, startX, endX int) color.Color {
-	var rs, gs, bs, as []int
+	at := rgbaAt(inputImage)
+	n := (endY - startY) * (endX - startX)
+	if n <= 0 {
+		return color.RGBA{}
+	}
+	rs, gs, bs, as := make([]int, 0, n), make([]int, 0, n), make([]int, 0, n), make([]int, 0, n)
 	for y := startY; y < endY; y++ {
 		for x := startX; x < endX; x++ {
-			c := inputImage.At(x, y)
-			r, g, b, a := c.RGBA()
+			r, g, b, a := at(x, y)
 			rs = append(rs, int(r))
 			gs = append(gs, int(g))
 			bs = append(bs, int(b))
@@ -80,62 +181,151 @@ func medianColor(inputImage image.Image, startY, endY, startX, endX int) color.C
 		}
 	}
 
-	sort.Ints(rs)
-	sort.Ints(gs)
-	sort.Ints(bs)
-	sort.Ints(as)
-
-	var mr, mg, mb, ma uint8
-	if m := len(rs) / 2; m%2 == 0 {
-		mr = uint8(rs[m])
-		mg = uint8(gs[m])
-		mb = uint8(bs[m])
-		ma = uint8(as[m])
-	} else {
-		mr = uint8((rs[m-1] + rs[m]) / 2)
-		mg = uint8((gs[m-1] + gs[m]) / 2)
-		mb = uint8((bs[m-1] + bs[m]) / 2)
-		ma = uint8((as[m-1] + as[m]) / 2)
-
-	}
-	median := color.RGBA{
-		R: mr,
-		G: mg,
-		B: mb,
-		A: ma,
+	median := func(vs []int) uint32 {
+		m := len(vs) / 2
+		selectKth(vs, m)
+		if len(vs)%2 == 0 {
+			// vs[:m] are all <= vs[m], so the other middle value is their max.
+			lo := vs[0]
+			for _, v := range vs[1:m] {
+				lo = intgr.Max(lo, v)
+			}
+			return uint32((lo + vs[m]) / 2)
+		}
+		return uint32(vs[m])
 	}
+	return rgba8(median(rs), median(gs), median(bs), median(as))
+}
 
-	return median
+// selectKth partially sorts vs so vs[k] is the kth smallest, those before it
+// are no larger and those after it no smaller, in linear time on average.
+func selectKth(vs []int, k int) {
+	lo, hi := 0, len(vs)-1
+	for lo < hi {
+		// Median of three as the pivot, which handles sorted runs well.
+		mid := lo + (hi-lo)/2
+		if vs[mid] < vs[lo] {
+			vs[mid], vs[lo] = vs[lo], vs[mid]
+		}
+		if vs[hi] < vs[lo] {
+			vs[hi], vs[lo] = vs[lo], vs[hi]
+		}
+		if vs[hi] < vs[mid] {
+			vs[hi], vs[mid] = vs[mid], vs[hi]
+		}
+		pivot := vs[mid]
+		i, j := lo, hi
+		for i <= j {
+			for vs[i] < pivot {
+				i++
+			}
+			for vs[j] > pivot {
+				j--
+			}
+			if i <= j {
+				vs[i], vs[j] = vs[j], vs[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case k <= j:
+			hi = j
+		case k >= i:
+			lo = i
+		default:
+			return
+		}
+	}
 }
 
 func meanColor(inputImage image.Image, startY, endY, startX, endX int) color.Color {
-	var sumr, sumb, sumg, suma uint32
-	var n uint32
+	// 64 bits so the sums of large blocks don't overflow.
+	var sumr, sumb, sumg, suma uint64
+	var n uint64
+	at := rgbaAt(inputImage)
 	for y := startY; y < endY; y++ {
 		for x := startX; x < endX; x++ {
-			c := inputImage.At(x, y)
-			r, g, b, a := c.RGBA()
-			sumr += r
-			sumg += g
-			sumb += b
-			suma += a
+			r, g, b, a := at(x, y)
+			sumr += uint64(r)
+			sumg += uint64(g)
+			sumb += uint64(b)
+			suma += uint64(a)
 			n++
 		}
 	}
+	if n == 0 {
+		return color.RGBA{}
+	}
+	return rgba8(uint32(sumr/n), uint32(sumg/n), uint32(sumb/n), uint32(suma/n))
+}
+
+// meanAggr returns meanColor working in the color space of opts.
+func meanAggr(opts ConvertOptions) colorAggrFn {
+	if s := colorSpaceOf(opts); s != colorSpaceSRGB {
+		return spaceAggr(s, meanOf)
+	}
+	return meanColor
+}
 
-	mr := sumr / n
-	mg := sumg / n
-	mb := sumb / n
-	ma := suma / n
+// medianAggr returns medianColor working in the color space of opts.
+func medianAggr(opts ConvertOptions) colorAggrFn {
+	if s := colorSpaceOf(opts); s != colorSpaceSRGB {
+		return spaceAggr(s, medianOf)
+	}
+	return medianColor
+}
+
+// spaceAggr returns an aggregator that combines each coordinate of the
+// straight colors in space, and alpha, with combine. Fully transparent pixels
+// only count towards alpha.
+func spaceAggr(space colorSpace, combine func([]float64) float64) colorAggrFn {
+	return func(inputImage image.Image, startY, endY, startX, endX int) color.Color {
+		at := rgbaAt(inputImage)
+		n := (endY - startY) * (endX - startX)
+		if n <= 0 {
+			return color.RGBA{}
+		}
+		xs, ys, zs, as := make([]float64, 0, n), make([]float64, 0, n), make([]float64, 0, n), make([]float64, 0, n)
+		for y := startY; y < endY; y++ {
+			for x := startX; x < endX; x++ {
+				r, g, b, a := at(x, y)
+				as = append(as, float64(a))
+				if a == 0 {
+					continue
+				}
+				f := 255 / float64(a)
+				cx, cy, cz := space.fromSRGB(float64(r)*f, float64(g)*f, float64(b)*f)
+				xs = append(xs, cx)
+				ys = append(ys, cy)
+				zs = append(zs, cz)
+			}
+		}
+		if len(xs) == 0 {
+			return color.RGBA{}
+		}
+		a := combine(as) / 0xffff
+		r, g, b := space.toSRGB(combine(xs), combine(ys), combine(zs))
+		premul := func(v float64) uint8 { return uint8(math.Round(math.Max(0, math.Min(255, v)) * a)) }
+		return color.RGBA{R: premul(r), G: premul(g), B: premul(b), A: uint8(math.Round(255 * a))}
+	}
+}
 
-	mean := color.RGBA{
-		R: uint8(mr),
-		G: uint8(mg),
-		B: uint8(mb),
-		A: uint8(ma),
+func meanOf(vs []float64) float64 {
+	var sum float64
+	for _, v := range vs {
+		sum += v
 	}
+	return sum / float64(len(vs))
+}
 
-	return mean
+func medianOf(vs []float64) float64 {
+	sort.Float64s(vs)
+	m := len(vs) / 2
+	if len(vs)%2 == 0 {
+		return (vs[m-1] + vs[m]) / 2
+	}
+	return vs[m]
 }
 
 type overlapConverter struct{ baseConverter }
@@ -147,15 +337,15 @@ func (c *overlapConverter) OutputFileName(input string, opts ConvertOptions) str
 }
 
 func overlapMean(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
-	return overlap(input, inputImage, opts.BlockSize(), opts, meanColor, true)
+	return overlap(input, inputImage, opts.BlockSize(), opts, meanAggr(opts), true)
 }
 
 func overlapMedian(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
-	return overlap(input, inputImage, opts.BlockSize(), opts, medianColor, true)
+	return overlap(input, inputImage, opts.BlockSize(), opts, medianAggr(opts), true)
 }
 
 func blockMean(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
-	return overlap(input, inputImage, opts.BlockSize(), opts, meanColor, false)
+	return overlap(input, inputImage, opts.BlockSize(), opts, meanAggr(opts), false)
 }
 
 func blockMedian(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
@@ -163,7 +353,7 @@ func blockMedian(input string, inputImage image.Image, opts ConvertOptions) (Con
 }
 
 func blockMedianFromBlockSize(input string, inputImage image.Image, blockSize int, opts ConvertOptions) (ConvertResult, error) {
-	return overlap(input, inputImage, blockSize, opts, medianColor, false)
+	return overlap(input, inputImage, blockSize, opts, medianAggr(opts), false)
 }
 
 func init() {
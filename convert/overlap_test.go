@@ -0,0 +1,149 @@
+package convert
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"testing"
+
+	"github.com/spudtrooper/goutil/or"
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+// serialOverlap draws the squares of overlap one after another, as overlap
+// did before it was split into bands.
+func serialOverlap(inputImage image.Image, blockSize int, aggr colorAggrFn) *image.RGBA {
+	b := inputImage.Bounds()
+	outputImage := image.NewRGBA(b)
+	inc := or.Int(blockSize, 10)
+	for y := b.Min.Y; y < b.Max.Y; y += inc {
+		for x := b.Min.X; x < b.Max.X; x += inc {
+			startY, endY := intgr.Max(y-inc, b.Min.Y), intgr.Min(y+inc, b.Max.Y)
+			startX, endX := intgr.Max(x-inc, b.Min.X), intgr.Min(x+inc, b.Max.X)
+			c := rgba8(aggr(inputImage, startY, endY, startX, endX).RGBA())
+			for y := startY; y < endY; y++ {
+				for x := startX; x < endX; x++ {
+					outputImage.Set(x, y, c)
+				}
+			}
+		}
+	}
+	return outputImage
+}
+
+func TestOverlapMatchesSerial(t *testing.T) {
+	// Bounds not at the origin and not a multiple of the block sizes.
+	src := randomImage(53, 37, 7)
+	offset := image.NewRGBA(image.Rect(5, 3, 58, 40))
+	draw.Draw(offset, offset.Bounds(), src, image.Point{}, draw.Src)
+
+	for _, img := range []image.Image{src, offset} {
+		for _, blockSize := range []int{1, 4, 10, 64} {
+			for name, aggr := range map[string]colorAggrFn{"mean": meanColor, "median": medianColor} {
+				want := serialOverlap(img, blockSize, aggr)
+				for _, threads := range []int{1, 3, 8, 0} {
+					res, err := overlap("", img, blockSize, MakeConvertOptions(ConvertThreads(threads)), aggr, false)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got := res.Image().(*image.RGBA)
+					if got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.Pix) {
+						t.Errorf("overlap(%v, blockSize=%d, %s, threads=%d) differs from serial", img.Bounds(), blockSize, name, threads)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRectBlockColorsThreads(t *testing.T) {
+	src := randomImage(53, 37, 7)
+	offset := image.NewRGBA(image.Rect(5, 3, 58, 40))
+	draw.Draw(offset, offset.Bounds(), src, image.Point{}, draw.Src)
+
+	for _, img := range []image.Image{src, offset} {
+		for _, size := range [][2]int{{1, 1}, {4, 8}, {10, 10}, {64, 64}} {
+			want := rectBlockColors(img, size[0], size[1], meanColor, 1)
+			if rows := (img.Bounds().Dy() + size[1] - 1) / size[1]; len(want) != rows {
+				t.Fatalf("rectBlockColors(%v, %dx%d) has %d rows, want %d", img.Bounds(), size[0], size[1], len(want), rows)
+			}
+			for _, threads := range []int{3, 8, 0} {
+				got := rectBlockColors(img, size[0], size[1], meanColor, threads)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("rectBlockColors(%v, %dx%d, threads=%d) differs from threads=1", img.Bounds(), size[0], size[1], threads)
+				}
+			}
+		}
+	}
+}
+
+// uniformImage is a w x h image of c.
+func uniformImage(w, h int, c color.Color) image.Image {
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// halvesImage is a w x h image whose left half is left and right half right.
+func halvesImage(w, h int, left, right color.Color) image.Image {
+	img := image.NewRGBA64(image.Rect(0, 0, w, h))
+	draw.Draw(img, image.Rect(0, 0, w/2, h), image.NewUniform(left), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(w/2, 0, w, h), image.NewUniform(right), image.Point{}, draw.Src)
+	return img
+}
+
+func TestAggregators(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		img       image.Image
+		mean, med color.RGBA
+	}{
+		{"white", uniformImage(4, 4, color.White), color.RGBA{255, 255, 255, 255}, color.RGBA{255, 255, 255, 255}},
+		{"black", uniformImage(4, 4, color.Black), color.RGBA{0, 0, 0, 255}, color.RGBA{0, 0, 0, 255}},
+		{"orange", uniformImage(3, 5, color.RGBA{255, 128, 0, 255}), color.RGBA{255, 128, 0, 255}, color.RGBA{255, 128, 0, 255}},
+		{"16 bit", uniformImage(2, 2, color.RGBA64{0x12ff, 0x3400, 0xabcd, 0xffff}), color.RGBA{0x12, 0x34, 0xab, 0xff}, color.RGBA{0x12, 0x34, 0xab, 0xff}},
+		{"translucent", uniformImage(2, 2, color.NRGBA{255, 0, 0, 128}), color.RGBA{128, 0, 0, 128}, color.RGBA{128, 0, 0, 128}},
+		{"black and white", halvesImage(4, 2, color.Black, color.White), color.RGBA{127, 127, 127, 255}, color.RGBA{127, 127, 127, 255}},
+		{"odd count", halvesImage(3, 1, color.Black, color.White), color.RGBA{170, 170, 170, 255}, color.RGBA{255, 255, 255, 255}},
+		// The sums overflow 32 bits.
+		{"large", uniformImage(300, 300, color.White), color.RGBA{255, 255, 255, 255}, color.RGBA{255, 255, 255, 255}},
+	} {
+		b := test.img.Bounds()
+		if got := meanColor(test.img, b.Min.Y, b.Max.Y, b.Min.X, b.Max.X); got != test.mean {
+			t.Errorf("%s: meanColor = %v, want %v", test.name, got, test.mean)
+		}
+		if got := medianColor(test.img, b.Min.Y, b.Max.Y, b.Min.X, b.Max.X); got != test.med {
+			t.Errorf("%s: medianColor = %v, want %v", test.name, got, test.med)
+		}
+	}
+}
+
+func TestOverlapJitter(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		c        color.Color
+		min, max color.RGBA
+	}{
+		{"white", color.White, color.RGBA{225, 225, 225, 255}, color.RGBA{255, 255, 255, 255}},
+		{"black", color.Black, color.RGBA{0, 0, 0, 255}, color.RGBA{30, 30, 30, 255}},
+		{"gray", color.RGBA{100, 100, 100, 255}, color.RGBA{70, 70, 70, 255}, color.RGBA{130, 130, 130, 255}},
+		{"translucent", color.NRGBA{255, 255, 255, 50}, color.RGBA{20, 20, 20, 50}, color.RGBA{50, 50, 50, 50}},
+	} {
+		res, err := overlap("", uniformImage(20, 20, test.c), 4, MakeConvertOptions(), meanColor, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img := res.Image().(*image.RGBA)
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 20; x++ {
+				c := img.RGBAAt(x, y)
+				if c.R < test.min.R || c.R > test.max.R || c.G < test.min.G || c.G > test.max.G ||
+					c.B < test.min.B || c.B > test.max.B || c.A != test.min.A {
+					t.Fatalf("%s: pixel (%d,%d) = %v, want between %v and %v", test.name, x, y, c, test.min, test.max)
+				}
+			}
+		}
+	}
+}
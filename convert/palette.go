@@ -0,0 +1,76 @@
+package convert
+
+import (
+	"fmt"
+	"image/color"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
+	"github.com/spudtrooper/goutil/or"
+)
+
+const defaultPaletteMethod = palette.MethodMedianCut
+
+// loadPalette returns the palette chosen with one of the Palette, PaletteFile
+// or PaletteSize options, or nil if none is set. With PaletteSize, the palette
+// is extracted from colorCounts, the histogram of the input image.
+func loadPalette(opts ConvertOptions, colorCounts map[color.RGBA]int) (color.Palette, error) {
+	var set int
+	for _, ok := range []bool{opts.Palette() != "", opts.PaletteFile() != "", opts.PaletteSize() > 0} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.Errorf("you can only specify one of a palette, a palette file or a palette size")
+	}
+	if opts.Palette() != "" {
+		return palette.Lookup(opts.Palette())
+	}
+	if opts.PaletteFile() != "" {
+		return palette.Load(opts.PaletteFile())
+	}
+	if opts.PaletteSize() > 0 {
+		method := palette.Method(or.String(opts.PaletteMethod(), string(defaultPaletteMethod)))
+		start := time.Now()
+		p, err := palette.Extract(palette.SortedColorCounts(colorCounts), opts.PaletteSize(), method)
+		if err != nil {
+			return nil, errors.Errorf("extracting palette: %v", err)
+		}
+		log.Printf("extracted %d colors from %d with %s in %v", len(p), len(colorCounts), method, time.Since(start))
+		return p, nil
+	}
+	return nil, nil
+}
+
+// paletteSpace returns the space to match palette colors in for opts, nil
+// for sRGB.
+func paletteSpace(opts ConvertOptions) palette.Space {
+	if s := colorSpaceOf(opts); s != colorSpaceSRGB {
+		return s.fromSRGB
+	}
+	return nil
+}
+
+// colorSpaceTag names a color space other than sRGB in output file names.
+func colorSpaceTag(opts ConvertOptions) string {
+	if s := colorSpaceOf(opts); s != colorSpaceSRGB {
+		return string(s)
+	}
+	return ""
+}
+
+// paletteTag names the chosen palette in output file names.
+func paletteTag(opts ConvertOptions) string {
+	if opts.PaletteFile() != "" {
+		base := path.Base(opts.PaletteFile())
+		return strings.TrimSuffix(base, path.Ext(base))
+	}
+	if opts.PaletteSize() > 0 {
+		return fmt.Sprintf("%s%d", or.String(opts.PaletteMethod(), string(defaultPaletteMethod)), opts.PaletteSize())
+	}
+	return opts.Palette()
+}
@@ -0,0 +1,80 @@
+package convert
+
+import (
+	"image"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const pipelineSep = "|"
+
+// pipelineConverter chains converters so the image produced by one stage is
+// the input to the next, e.g. "block_median|websafe_pixelated".
+type pipelineConverter struct {
+	stages []Converter
+}
+
+func isPipeline(name string) bool {
+	return strings.Contains(name, pipelineSep)
+}
+
+func makePipelineConverter(name string, reg *convReg) (*pipelineConverter, error) {
+	var stages []Converter
+	for i, stageName := range strings.Split(name, pipelineSep) {
+		stageName = strings.TrimSpace(stageName)
+		if stageName == "" {
+			return nil, errors.Errorf("empty stage %d in pipeline %q", i+1, name)
+		}
+		c := reg.Get(stageName)
+		if c == nil {
+			return nil, errors.Errorf("invalid converter string for stage %d in pipeline %q: %s", i+1, name, stageName)
+		}
+		stages = append(stages, c)
+	}
+	return &pipelineConverter{stages: stages}, nil
+}
+
+func (p *pipelineConverter) Name() string {
+	var names []string
+	for _, s := range p.stages {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, pipelineSep)
+}
+
+// OutputFileName feeds the output name of each stage into the next, so the
+// final name encodes the whole chain, e.g. "foo-block_median-0010-websafe_pixelated.jpg".
+func (p *pipelineConverter) OutputFileName(input string, opts ConvertOptions) string {
+	output := input
+	for _, s := range p.stages {
+		output = s.OutputFileName(output, opts)
+	}
+	return output
+}
+
+// sizesOutput is that of the last stage, whose output is the result.
+func (p *pipelineConverter) sizesOutput() bool {
+	return sizesOutput(p.stages[len(p.stages)-1])
+}
+
+func (p *pipelineConverter) Convert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	var res ConvertResult
+	img := inputImage
+	for i, s := range p.stages {
+		if img == nil {
+			prev := p.stages[i-1]
+			return nil, errors.Errorf("stage %d (%s) produced no image to pass to stage %d (%s)", i, prev.Name(), i+1, s.Name())
+		}
+		r, err := s.Convert(input, img, opts)
+		if err != nil {
+			return nil, errors.Errorf("stage %d (%s): %v", i+1, s.Name(), err)
+		}
+		if r == nil {
+			return nil, errors.Errorf("stage %d (%s) returned nil result", i+1, s.Name())
+		}
+		res = r
+		img = r.Image()
+	}
+	return res, nil
+}
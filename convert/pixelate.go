@@ -4,17 +4,22 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"os"
 	"path"
 	"strings"
 
-	"github.com/markdaws/go-effects/pkg/effects"
 	"github.com/nfnt/resize"
 	"github.com/pkg/errors"
+	"github.com/spudtrooper/eightbit/palette"
 	"github.com/spudtrooper/goutil/check"
+	"github.com/spudtrooper/goutil/or"
+	"github.com/thomaso-mirodin/intmath/intgr"
 )
 
-type convertPixelatedImageFn func(inputImage, pixelatedImg image.Image, pixelatedWidth, pixelatedHeight int) image.Image
+// convertPixelatedImageFn post-processes the pixelated image at the working
+// resolution. The result is scaled back to the size of the input afterwards.
+type convertPixelatedImageFn func(pixelatedImg image.Image, opts ConvertOptions) (image.Image, error)
+
+const defaultPixelateResolution = 1280
 
 type pixelatedConverter struct {
 	convertFn convertPixelatedImageFn
@@ -32,104 +37,80 @@ func (c *pixelatedConverter) OutputFileName(input string, opts ConvertOptions) s
 func (p *pixelatedConverter) Convert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
 	check.Check(p.convertFn != nil, check.CheckMessage(fmt.Sprintf("%s converter has nil convert function", p.Name())))
 
-	pixelated := input + "-pixelated.jpg"
-	resized := input + "-resized" + path.Ext(input)
-	defer func() {
-		if err := os.Remove(pixelated); err != nil {
-			log.Printf("trying to delete pixelated: %s: %v", pixelated, err)
-		}
-		if err := os.Remove(resized); err != nil {
-			log.Printf("trying to delete resized: %s: %v", resized, err)
-		}
-	}()
-
-	// First resize the image to 1280,1280 so that we can apply the effects
-	resizedImage := resize.Resize(1280, 1280, inputImage, resize.Lanczos3)
-	if err := encodeImage(resized, resizedImage); err != nil {
-		return nil, errors.Errorf("writing resized image to %s", resized)
-	}
-
-	img, err := effects.LoadImage(resized)
-	if err != nil {
-		return nil, errors.Errorf("loading image %s: %v", input, err)
-	}
-	pixelatedEffectsImg, err := effects.NewPixelate(opts.PixelateBlockSize()).Apply(img, 1)
-	if err != nil {
-		return nil, errors.Errorf("pixelating image %s: %v", input, err)
+	// First resize the image so its longest side is the working resolution,
+	// keeping the aspect ratio, so that we can pixelate it.
+	bounds := inputImage.Bounds()
+	if bounds.Empty() {
+		return nil, errors.Errorf("cannot pixelate an empty %v image", bounds)
 	}
+	workingWidth, workingHeight := pixelateWorkingSize(bounds.Dx(), bounds.Dy(), or.Int(int(opts.PixelateResolution()), defaultPixelateResolution))
+	resizedImage := resize.Resize(uint(workingWidth), uint(workingHeight), inputImage, resize.Lanczos3)
+	pixelatedImg := pixelate(resizedImage, opts.PixelateBlockSize())
 
-	saveOpts := effects.SaveOpts{}
-	if err := pixelatedEffectsImg.Save(pixelated, saveOpts); err != nil {
-		return nil, errors.Errorf("outputting image %s to %s: %v", input, pixelated, err)
-	}
-
-	pixelatedImg, err := decode(pixelated)
+	// Then scale back to the original size without smoothing the blocks.
+	convertedImg, err := p.convertFn(pixelatedImg, opts)
 	if err != nil {
-		return nil, errors.Errorf("encoding pixelated image %s: %v", pixelated, err)
+		return nil, err
 	}
-
-	outputImg := p.convertFn(inputImage, pixelatedImg, pixelatedEffectsImg.Width, pixelatedEffectsImg.Height)
+	outputImg := resize.Resize(uint(bounds.Dx()), uint(bounds.Dy()), convertedImg, resize.NearestNeighbor)
 	res := makeImageConvertResult(outputImg)
 
 	return res, nil
 }
 
-func simpleConvert(inputImage, pixelatedImg image.Image, pixelatedWidth, pixelatedHeight int) image.Image {
-	minY, maxY := inputImage.Bounds().Min.Y, inputImage.Bounds().Max.Y
-	minX, maxX := inputImage.Bounds().Min.X, inputImage.Bounds().Max.X
-	outputImg := image.NewRGBA(image.Rect(minX, minY, maxX, maxY))
-	for y := pixelatedImg.Bounds().Min.Y; y < pixelatedImg.Bounds().Max.Y; y++ {
-		for x := pixelatedImg.Bounds().Min.X; x < pixelatedImg.Bounds().Max.X; x++ {
-			c := pixelatedImg.At(x, y)
-			outputImg.Set(x, y, c)
-		}
+// pixelateWorkingSize scales width x height so the longest side is resolution,
+// keeping the aspect ratio.
+func pixelateWorkingSize(width, height, resolution int) (int, int) {
+	if width >= height {
+		return resolution, intgr.Max(1, height*resolution/width)
 	}
-
-	return outputImg
+	return intgr.Max(1, width*resolution/height), resolution
 }
 
-func websafeConvert(inputImage, pixelatedImg image.Image, pixelatedWidth, pixelatedHeight int) image.Image {
-	colorsForPalette := func() []color.Color {
-		var cols []color.Color
-		cols = append(cols,
-			color.NRGBA{uint8(0xFF), uint8(0xFF), uint8(0xFF), 255}, // White
-			color.NRGBA{uint8(0xC0), uint8(0xC0), uint8(0xC0), 255}, // Silver
-			color.NRGBA{uint8(0x80), uint8(0x80), uint8(0x80), 255}, // Gray
-			color.NRGBA{uint8(0x00), uint8(0x00), uint8(0x00), 255}, // Black
-			color.NRGBA{uint8(0xFF), uint8(0x00), uint8(0x00), 255}, // Red
-			color.NRGBA{uint8(0x80), uint8(0x00), uint8(0x00), 255}, // Maroon
-			color.NRGBA{uint8(0xFF), uint8(0xFF), uint8(0x00), 255}, // Yellow
-			color.NRGBA{uint8(0x80), uint8(0x80), uint8(0x00), 255}, // Olive
-			color.NRGBA{uint8(0x00), uint8(0xFF), uint8(0x00), 255}, // Lime
-			color.NRGBA{uint8(0x00), uint8(0x80), uint8(0x00), 255}, // Green
-			color.NRGBA{uint8(0x00), uint8(0xFF), uint8(0xFF), 255}, // Aqua
-			color.NRGBA{uint8(0x00), uint8(0x80), uint8(0x80), 255}, // Teal
-			color.NRGBA{uint8(0x00), uint8(0x00), uint8(0xFF), 255}, // Blue
-			color.NRGBA{uint8(0x00), uint8(0x00), uint8(0x80), 255}, // Navy
-			color.NRGBA{uint8(0xFF), uint8(0x00), uint8(0xFF), 255}, // Fuchsia
-			color.NRGBA{uint8(0x80), uint8(0x00), uint8(0x80), 255}, // Purple
-		)
-		newComps := []int{0x20, 0x60, 0xa0}
-		for _, r := range newComps {
-			for _, g := range newComps {
-				for _, b := range newComps {
-					c := color.RGBA{uint8(r), uint8(g), uint8(b), 255}
-					cols = append(cols, c)
+// pixelate replaces each blockSize x blockSize block of inputImage with the mean
+// color of that block. Blocks on the right and bottom edges may be smaller when
+// blockSize doesn't evenly divide the image. The result starts at (0, 0).
+func pixelate(inputImage image.Image, blockSize int) *image.RGBA {
+	bounds := inputImage.Bounds()
+	outputImg := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	inc := or.Int(blockSize, 16)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += inc {
+		for x := bounds.Min.X; x < bounds.Max.X; x += inc {
+			endY := intgr.Min(y+inc, bounds.Max.Y)
+			endX := intgr.Min(x+inc, bounds.Max.X)
+			var sumr, sumg, sumb, n uint32
+			for yy := y; yy < endY; yy++ {
+				for xx := x; xx < endX; xx++ {
+					r, g, b, _ := inputImage.At(xx, yy).RGBA()
+					sumr += r >> 8
+					sumg += g >> 8
+					sumb += b >> 8
+					n++
+				}
+			}
+			c := color.RGBA{
+				R: uint8(sumr / n),
+				G: uint8(sumg / n),
+				B: uint8(sumb / n),
+				A: 255,
+			}
+			for yy := y; yy < endY; yy++ {
+				for xx := x; xx < endX; xx++ {
+					outputImg.SetRGBA(xx-bounds.Min.X, yy-bounds.Min.Y, c)
 				}
 			}
-		}
-		return cols
-	}
-	palette := color.Palette(colorsForPalette())
-	palettedImg := image.NewPaletted(image.Rect(0, 0, pixelatedWidth, pixelatedHeight), palette)
-	for y := pixelatedImg.Bounds().Min.Y; y < pixelatedImg.Bounds().Max.Y; y++ {
-		for x := pixelatedImg.Bounds().Min.X; x < pixelatedImg.Bounds().Max.X; x++ {
-			c := pixelatedImg.At(x, y)
-			palettedImg.Set(x, y, c)
 		}
 	}
+	return outputImg
+}
+
+func simpleConvert(pixelatedImg image.Image, opts ConvertOptions) (image.Image, error) {
+	return pixelatedImg, nil
+}
 
-	return palettedImg
+func websafeConvert(pixelatedImg image.Image, opts ConvertOptions) (image.Image, error) {
+	p, _ := palette.Get("html")
+	return palette.ApplyDitheredIn(pixelatedImg, p.Colors, palette.Dither(opts.Dither()), paletteSpace(opts))
 }
 
 func init() {
@@ -0,0 +1,34 @@
+package convert
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+func TestPixelateEmptyImage(t *testing.T) {
+	for _, name := range AllConverterNames() {
+		if !strings.HasSuffix(name, "pixelated") {
+			continue
+		}
+		for _, r := range []image.Rectangle{image.Rect(0, 0, 0, 0), image.Rect(0, 0, 16, 0)} {
+			if _, err := ConvertImage(image.NewRGBA(r), name); err == nil {
+				t.Errorf("%s: ConvertImage of %v succeeded", name, r)
+			}
+		}
+	}
+}
+
+func TestPixelateWorkingSize(t *testing.T) {
+	for _, test := range []struct {
+		w, h, res, wantW, wantH int
+	}{
+		{100, 50, 10, 10, 5},
+		{50, 100, 10, 5, 10},
+		{1000, 1, 10, 10, 1},
+	} {
+		if w, h := pixelateWorkingSize(test.w, test.h, test.res); w != test.wantW || h != test.wantH {
+			t.Errorf("pixelateWorkingSize(%d, %d, %d) = %dx%d, want %dx%d", test.w, test.h, test.res, w, h, test.wantW, test.wantH)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+)
+
+// rgbaFunc returns the alpha-premultiplied 16-bit components of the pixel at
+// x, y, exactly like At(x, y).RGBA() but without going through color.Color.
+type rgbaFunc func(x, y int) (r, g, b, a uint32)
+
+// fastImage is an image with a fast rgbaFunc, computed once by fastPixels so
+// that the aggregators, which run per block, don't redo it.
+type fastImage struct {
+	image.Image
+	rgba rgbaFunc
+}
+
+// fastPixels wraps img for the aggregators. A YCbCr image, as decoded from
+// JPEG, is converted once to RGBA64, which keeps the 16 bits of precision of
+// color.YCbCr.RGBA, since the aggregators read each pixel several times.
+func fastPixels(img image.Image) image.Image {
+	switch img := img.(type) {
+	case *fastImage:
+		return img
+	case *image.YCbCr:
+		return &fastImage{img, rgbaAt(ycbcrToRGBA64(img))}
+	}
+	return &fastImage{img, rgbaAt(img)}
+}
+
+func ycbcrToRGBA64(img *image.YCbCr) *image.RGBA64 {
+	b := img.Bounds()
+	res := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		i := res.PixOffset(b.Min.X, y)
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			r, g, bl, _ := color.YCbCr{Y: img.Y[yi], Cb: img.Cb[ci], Cr: img.Cr[ci]}.RGBA()
+			s := res.Pix[i : i+8 : i+8]
+			s[0], s[1] = uint8(r>>8), uint8(r)
+			s[2], s[3] = uint8(g>>8), uint8(g)
+			s[4], s[5] = uint8(bl>>8), uint8(bl)
+			s[6], s[7] = 0xff, 0xff
+			i += 8
+		}
+	}
+	return res
+}
+
+// rgbaAt returns an rgbaFunc for img with fast paths for the common types.
+func rgbaAt(img image.Image) rgbaFunc {
+	switch img := img.(type) {
+	case *fastImage:
+		return img.rgba
+	case *image.RGBA:
+		return func(x, y int) (r, g, b, a uint32) {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+4 : i+4]
+			r, g, b, a = uint32(s[0]), uint32(s[1]), uint32(s[2]), uint32(s[3])
+			return r | r<<8, g | g<<8, b | b<<8, a | a<<8
+		}
+	case *image.RGBA64:
+		return func(x, y int) (r, g, b, a uint32) {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+8 : i+8]
+			return uint32(s[0])<<8 | uint32(s[1]), uint32(s[2])<<8 | uint32(s[3]),
+				uint32(s[4])<<8 | uint32(s[5]), uint32(s[6])<<8 | uint32(s[7])
+		}
+	case *image.NRGBA:
+		return func(x, y int) (r, g, b, a uint32) {
+			i := img.PixOffset(x, y)
+			s := img.Pix[i : i+4 : i+4]
+			// As in color.NRGBA.RGBA.
+			r, g, b, a = uint32(s[0]), uint32(s[1]), uint32(s[2]), uint32(s[3])
+			r |= r << 8
+			r *= a
+			r /= 0xff
+			g |= g << 8
+			g *= a
+			g /= 0xff
+			b |= b << 8
+			b *= a
+			b /= 0xff
+			a |= a << 8
+			return r, g, b, a
+		}
+	case *image.YCbCr:
+		return func(x, y int) (r, g, b, a uint32) {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			return color.YCbCr{Y: img.Y[yi], Cb: img.Cb[ci], Cr: img.Cr[ci]}.RGBA()
+		}
+	case *image.Paletted:
+		table := make([][4]uint32, len(img.Palette))
+		for i, c := range img.Palette {
+			r, g, b, a := c.RGBA()
+			table[i] = [4]uint32{r, g, b, a}
+		}
+		return func(x, y int) (r, g, b, a uint32) {
+			c := table[img.Pix[img.PixOffset(x, y)]]
+			return c[0], c[1], c[2], c[3]
+		}
+	}
+	return func(x, y int) (r, g, b, a uint32) {
+		return img.At(x, y).RGBA()
+	}
+}
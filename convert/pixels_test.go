@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"math/rand"
+	"path"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// slowImage hides the type of an image, so only the generic path applies.
+type slowImage struct{ image.Image }
+
+func TestRGBAAtMatchesAt(t *testing.T) {
+	src := randomImage(17, 11, 3)
+	b := image.Rect(2, 1, 19, 12)
+
+	rgba := image.NewRGBA(b)
+	draw.Draw(rgba, b, src, image.Point{}, draw.Src)
+	nrgba := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			// Translucent pixels exercise premultiplying.
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 13), uint8(y * 29), uint8(x * y), uint8(x*y*7 + 40)})
+		}
+	}
+	ycbcr := image.NewYCbCr(b, image.YCbCrSubsampleRatio420)
+	for i := range ycbcr.Y {
+		ycbcr.Y[i] = uint8(i * 7)
+	}
+	for i := range ycbcr.Cb {
+		ycbcr.Cb[i], ycbcr.Cr[i] = uint8(i*11), uint8(255-i*5)
+	}
+	paletted := image.NewPaletted(b, palette.Plan9)
+	draw.Draw(paletted, b, src, image.Point{}, draw.Src)
+
+	rgba64 := image.NewRGBA64(b)
+	draw.Draw(rgba64, b, nrgba, b.Min, draw.Src)
+
+	for _, img := range []image.Image{rgba, nrgba, ycbcr, paletted, rgba64, slowImage{rgba}, fastPixels(nrgba), fastPixels(ycbcr)} {
+		at := rgbaAt(img)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, a := at(x, y)
+				wr, wg, wb, wa := img.At(x, y).RGBA()
+				if r != wr || g != wg || bl != wb || a != wa {
+					t.Fatalf("%T at (%d,%d) = %d,%d,%d,%d, want %d,%d,%d,%d", img, x, y, r, g, bl, a, wr, wg, wb, wa)
+				}
+			}
+		}
+	}
+}
+
+func TestSelectKth(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for n := 1; n < 60; n++ {
+		for k := 0; k < n; k++ {
+			vs := make([]int, n)
+			for i := range vs {
+				// Few distinct values, so there are many duplicates.
+				vs[i] = r.Intn(n/2 + 1)
+			}
+			sorted := append([]int{}, vs...)
+			sort.Ints(sorted)
+			selectKth(vs, k)
+			if vs[k] != sorted[k] {
+				t.Fatalf("n=%d: selectKth(%d) = %d, want %d", n, k, vs[k], sorted[k])
+			}
+			for i, v := range vs {
+				if (i < k && v > vs[k]) || (i > k && v < vs[k]) {
+					t.Fatalf("n=%d k=%d: %v isn't partitioned around %d", n, k, vs, vs[k])
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkOverlap(b *testing.B) {
+	files, err := filepath.Glob("../examples/in/*.jpg")
+	if err != nil || len(files) == 0 {
+		b.Skip("no images in examples/in")
+	}
+	for _, file := range files {
+		img, _, err := decode(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, aggr := range []struct {
+			name string
+			fn   colorAggrFn
+		}{{"mean", meanColor}, {"median", medianColor}} {
+			for _, v := range []struct {
+				name string
+				img  image.Image
+			}{{"fast", img}, {"generic", slowImage{img}}} {
+				b.Run(fmt.Sprintf("%s/%s/%s", path.Base(file), aggr.name, v.name), func(b *testing.B) {
+					opts := MakeConvertOptions(ConvertThreads(1))
+					for i := 0; i < b.N; i++ {
+						if _, err := overlap("", v.img, 4, opts, aggr.fn, false); err != nil {
+							b.Fatal(err)
+						}
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nfnt/resize"
+	"github.com/pkg/errors"
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+// upperHalfBlock is drawn with the top pixel of a pair as the foreground and
+// the bottom one as the background, so each character shows two pixels.
+const upperHalfBlock = "▀"
+
+// Preview prints output, a file written by Convert, to w: text as it is and
+// images scaled to width columns using 24-bit color half blocks.
+func Preview(w io.Writer, output string, width int) error {
+	switch strings.ToLower(path.Ext(output)) {
+	case ".txt", ".ans":
+		b, err := os.ReadFile(output)
+		if err != nil {
+			return errors.Errorf("reading %s: %v", output, err)
+		}
+		_, err = w.Write(b)
+		return err
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		return errors.Errorf("opening %s: %v", output, err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return errors.Errorf("no preview of %s: %v", output, err)
+	}
+	_, err = io.WriteString(w, halfBlocks(img, width))
+	return err
+}
+
+// halfBlocks renders img scaled to width columns, keeping its aspect ratio.
+func halfBlocks(img image.Image, width int) string {
+	b := img.Bounds()
+	if width <= 0 || b.Dx() == 0 {
+		return ""
+	}
+	// Each character is about twice as high as it is wide and shows two rows,
+	// so one pixel per column and row keeps the aspect ratio.
+	height := intgr.Max(2, roundUp(b.Dy()*width/b.Dx(), 2))
+	img = resize.Resize(uint(width), uint(height), img, resize.NearestNeighbor)
+	b = img.Bounds()
+
+	rgb := func(c color.Color) (uint32, uint32, uint32) {
+		r, g, b, _ := c.RGBA()
+		return r >> 8, g >> 8, b >> 8
+	}
+	var s strings.Builder
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			tr, tg, tb := rgb(img.At(x, y))
+			br, bg, bb := rgb(img.At(x, y+1))
+			fmt.Fprintf(&s, "\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm%s", tr, tg, tb, br, bg, bb, upperHalfBlock)
+		}
+		s.WriteString(ansiReset + "\n")
+	}
+	return s.String()
+}
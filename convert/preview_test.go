@@ -0,0 +1,21 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestHalfBlocks(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 4))
+	for x := 0; x < 2; x++ {
+		img.Set(x, 0, color.RGBA{255, 0, 0, 255})
+		img.Set(x, 1, color.RGBA{255, 0, 0, 255})
+		img.Set(x, 2, color.RGBA{0, 0, 255, 255})
+		img.Set(x, 3, color.RGBA{0, 0, 255, 255})
+	}
+	// Scaled to 1 column the image is 1x2 pixels: red over blue.
+	if got, want := halfBlocks(img, 1), "\x1b[38;2;255;0;0m\x1b[48;2;0;0;255m▀\x1b[0m\n"; got != want {
+		t.Errorf("halfBlocks = %q, want %q", got, want)
+	}
+}
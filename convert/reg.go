@@ -1,5 +1,7 @@
 package convert
 
+import "github.com/pkg/errors"
+
 var (
 	globalReg = makeConverterRegistry()
 )
@@ -26,6 +28,19 @@ func (r *convReg) Get(name string) Converter {
 	return r.reg[name]
 }
 
+// Lookup returns the converter registered under name or, if name is a pipeline
+// like "block_median|websafe_pixelated", a converter chaining each stage.
+func (r *convReg) Lookup(name string) (Converter, error) {
+	if isPipeline(name) {
+		return makePipelineConverter(name, r)
+	}
+	c := r.Get(name)
+	if c == nil {
+		return nil, errors.Errorf("invalid converter string: %s", name)
+	}
+	return c, nil
+}
+
 func (r *convReg) AllConverterNames() []string {
 	var names []string
 	for n := range r.reg {
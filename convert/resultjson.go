@@ -0,0 +1,70 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+type blocksJSON struct {
+	BlockSize int `json:"block_size"`
+	Rows      int `json:"rows"`
+	Cols      int `json:"cols"`
+	// Hex colors indexed by [row][col].
+	Colors [][]string `json:"colors"`
+}
+
+type resultJSON struct {
+	Input      string         `json:"input"`
+	Output     string         `json:"output"`
+	Converter  string         `json:"converter"`
+	DurationMS float64        `json:"duration_ms"`
+	Width      int            `json:"width,omitempty"`
+	Height     int            `json:"height,omitempty"`
+	Palette    []string       `json:"palette,omitempty"`
+	ColorHist  map[string]int `json:"color_hist,omitempty"`
+	Blocks     *blocksJSON    `json:"blocks,omitempty"`
+}
+
+func makeResultJSON(input, output string, conv Converter, res ConvertResult) resultJSON {
+	r := resultJSON{
+		Input:      input,
+		Output:     output,
+		Converter:  conv.Name(),
+		DurationMS: float64(res.Duration().Microseconds()) / 1000,
+		ColorHist:  res.ColorHist(),
+	}
+	if img := res.Image(); img != nil {
+		r.Width, r.Height = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+	for _, c := range res.Palette() {
+		r.Palette = append(r.Palette, colorHex(c))
+	}
+	if g := res.Blocks(); g != nil {
+		b := &blocksJSON{BlockSize: g.BlockSize, Rows: len(g.Colors)}
+		for _, row := range g.Colors {
+			var hexes []string
+			for _, c := range row {
+				hexes = append(hexes, colorHex(c))
+			}
+			b.Colors = append(b.Colors, hexes)
+			b.Cols = len(row)
+		}
+		r.Blocks = b
+	}
+	return r
+}
+
+// writeResultJSON writes the results of a Convert call as a JSON array, one
+// object per output.
+func writeResultJSON(file string, results []resultJSON) error {
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return errors.Errorf("marshaling results: %v", err)
+	}
+	if err := os.WriteFile(file, append(b, '\n'), 0644); err != nil {
+		return errors.Errorf("writing %s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package convert
+
+import (
+	"encoding/json"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestResultJSON(t *testing.T) {
+	img := randomImage(20, 10, 5)
+	res, err := blockMean("", img, MakeConvertOptions(ConvertBlockSize(10)))
+	if err != nil {
+		t.Fatalf("blockMean: %v", err)
+	}
+	pal := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}
+	res = withDuration(withPalette(res, pal), 1500*time.Microsecond)
+
+	b, err := json.Marshal(makeResultJSON("in.png", "out.png", globalReg.Get("block_mean"), res))
+	if err != nil {
+		t.Fatalf("marshaling: %v", err)
+	}
+	var got resultJSON
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("unmarshaling: %v", err)
+	}
+	if got.Converter != "block_mean" || got.Width != 20 || got.Height != 10 || got.DurationMS != 1.5 {
+		t.Errorf("result = %+v", got)
+	}
+	if len(got.Palette) != 2 || got.Palette[1] != "#ffffff" {
+		t.Errorf("palette = %v, want [#000000 #ffffff]", got.Palette)
+	}
+	if got.Blocks == nil || got.Blocks.Rows != 1 || got.Blocks.Cols != 2 {
+		t.Fatalf("blocks = %+v, want 2x1", got.Blocks)
+	}
+	if want := colorHex(res.Image().At(10, 0)); got.Blocks.Colors[0][1] != want {
+		t.Errorf("block color = %q, want %q", got.Blocks.Colors[0][1], want)
+	}
+	var n int
+	for _, c := range got.ColorHist {
+		n += c
+	}
+	if n != 2 {
+		t.Errorf("color hist counts %d blocks, want 2", n)
+	}
+}
+
+func TestColorHistAfterPostProcess(t *testing.T) {
+	img := randomImage(20, 10, 5)
+	res, err := ConvertImage(img, "block_mean", ConvertBlockSize(5), ConvertPalette("gameboy_dmg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	inPalette := map[string]bool{}
+	for _, c := range res.Palette() {
+		inPalette[colorHex(c)] = true
+	}
+	var n int
+	for hex, c := range res.ColorHist() {
+		if !inPalette[hex] {
+			t.Errorf("color hist has %s, which isn't in the palette", hex)
+		}
+		n += c
+	}
+	if n != 8 {
+		t.Errorf("color hist counts %d blocks, want 8", n)
+	}
+
+	res, err = ConvertImage(img, "block_mean", ConvertBlockSize(5), ConvertResizeWidth(7), ConvertResizeHeight(7))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := res.ColorHist(); h != nil {
+		t.Errorf("color hist of a resized image = %v, want none", h)
+	}
+}
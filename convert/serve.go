@@ -0,0 +1,400 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/goutil/or"
+	"github.com/thomaso-mirodin/intmath/intgr"
+)
+
+const defaultMaxUploadBytes = 32 << 20
+
+// defaultMaxPixels caps the decoded size of uploads, which compress well.
+const defaultMaxPixels = 64 << 20
+
+// maxAnimateFrames caps the frames of an animation, one per block size, so a
+// single request can't ask for an unbounded amount of work.
+const maxAnimateFrames = 150
+
+// Limits on how long reading a request may take, headers and body included.
+const (
+	serveReadHeaderTimeout = 10 * time.Second
+	serveReadTimeout       = time.Minute
+)
+
+var errUploadTooLarge = errors.New("upload too large")
+
+// serveParam is a query parameter of /convert that sets a ConvertOption. The
+// names are those of the command line flags.
+type serveParam struct {
+	name, doc string
+	option    func(v string) (ConvertOption, error)
+}
+
+func intParam(f func(int) ConvertOption) func(string) (ConvertOption, error) {
+	return func(v string) (ConvertOption, error) {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		return f(n), nil
+	}
+}
+
+func uintParam(f func(uint) ConvertOption) func(string) (ConvertOption, error) {
+	return func(v string) (ConvertOption, error) {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		return f(uint(n)), nil
+	}
+}
+
+func boolParam(f func(bool) ConvertOption) func(string) (ConvertOption, error) {
+	return func(v string) (ConvertOption, error) {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, err
+		}
+		return f(b), nil
+	}
+}
+
+func stringParam(f func(string) ConvertOption) func(string) (ConvertOption, error) {
+	return func(v string) (ConvertOption, error) { return f(v), nil }
+}
+
+var serveParams = []serveParam{
+	{"block_size", "block size of the overlap, block and text converters", intParam(ConvertBlockSize)},
+	{"pixelate_block_size", "block size of the pixelated converters", intParam(ConvertPixelateBlockSize)},
+	{"pixelate_resolution", "longest side of the working image of the pixelated converters", uintParam(ConvertPixelateResolution)},
+	{"resize_width", "width of the result; needs resize_height", uintParam(ConvertResizeWidth)},
+	{"resize_height", "height of the result; needs resize_width", uintParam(ConvertResizeHeight)},
+	{"palette", "name of a palette to reduce the result to", stringParam(ConvertPalette)},
+	{"palette_size", "number of colors of a palette derived from the upload", intParam(ConvertPaletteSize)},
+	{"palette_method", "how to derive the palette for palette_size", stringParam(ConvertPaletteMethod)},
+	{"dither", "dithering when reducing to a palette", stringParam(ConvertDither)},
+	{"color_space", "color space to aggregate blocks and match palette colors in: srgb, linear, lab or oklab", stringParam(ConvertColorSpace)},
+	{"gameboy_green", "use the green shades of the original Game Boy", boolParam(ConvertGameboyGreen)},
+	{"text_median", "use the median color of each block for the text converters", boolParam(ConvertTextMedian)},
+	{"animate_reverse", "go from higher to lower block sizes", boolParam(ConvertAnimateReverse)},
+}
+
+// The animation range is three parameters setting a single option. The number
+// of animation threads isn't a parameter; the server picks it.
+var animateRangeParams = []string{"animate_block_size_start", "animate_block_size_end", "animate_block_size_step"}
+
+// commonParams apply to every converter.
+var commonParams = []string{"resize_width", "resize_height", "palette", "palette_size", "palette_method", "dither", "color_space"}
+
+// paramsConverter is implemented by converters that read options beyond the
+// common ones, to list them in /converters.
+type paramsConverter interface {
+	params() []string
+}
+
+func (c *overlapConverter) params() []string { return []string{"block_size"} }
+func (c *pixelatedConverter) params() []string {
+	return []string{"pixelate_block_size", "pixelate_resolution"}
+}
+func (c *gameboyConverter) params() []string { return []string{"gameboy_green"} }
+func (c *textConverter) params() []string    { return []string{"block_size", "text_median"} }
+func (c *animateConverter) params() []string {
+	return append([]string{"animate_reverse"}, animateRangeParams...)
+}
+
+func (p *pipelineConverter) params() []string {
+	var res []string
+	seen := map[string]bool{}
+	for _, s := range p.stages {
+		for _, param := range converterParams(s) {
+			if !seen[param] {
+				seen[param] = true
+				res = append(res, param)
+			}
+		}
+	}
+	return res
+}
+
+func converterParams(c Converter) []string {
+	if p, ok := c.(paramsConverter); ok {
+		return p.params()
+	}
+	return nil
+}
+
+// parseServeParams turns the query of a /convert request into options,
+// starting from the defaults of the command line.
+func parseServeParams(query map[string][]string) ([]ConvertOption, error) {
+	opts := []ConvertOption{ConvertBlockSize(10), ConvertPixelateBlockSize(16)}
+	for _, p := range serveParams {
+		if vs, ok := query[p.name]; ok && len(vs) > 0 {
+			opt, err := p.option(vs[0])
+			if err != nil {
+				return nil, errors.Errorf("invalid %s: %v", p.name, err)
+			}
+			opts = append(opts, opt)
+		}
+	}
+	animateRange := []int{1, 150, 1}
+	for i, name := range animateRangeParams {
+		if vs, ok := query[name]; ok && len(vs) > 0 {
+			n, err := strconv.Atoi(vs[0])
+			if err != nil {
+				return nil, errors.Errorf("invalid %s: %v", name, err)
+			}
+			animateRange[i] = n
+		}
+	}
+	if start, end, step := animateRange[0], animateRange[1], animateRange[2]; step > 0 && start < end {
+		if frames := (end-start)/step + 1; frames > maxAnimateFrames {
+			return nil, errors.Errorf("animation of %d frames is over the limit of %d", frames, maxAnimateFrames)
+		}
+	}
+	opts = append(opts, ConvertAnimateBlockSizeRange(MakeBlockSizeRange(animateRange[0], animateRange[1], animateRange[2])))
+	return opts, nil
+}
+
+type server struct {
+	maxUploadBytes int64
+	maxPixels      int64
+	// Holds a value per conversion in flight.
+	sem chan struct{}
+	// Threads of each conversion, so that together they use about a CPU each.
+	threads int
+}
+
+// MakeHandler returns an HTTP handler serving the converters:
+//
+//	POST /convert?converter=NAME&format=.png&block_size=10...
+//	    converts the image in the body, raw or as the "image" field of a
+//	    multipart form, and responds with the result
+//	GET /converters
+//	    lists the converters and the parameters they take as JSON
+func MakeHandler(sOpts ...ServeOption) http.Handler {
+	opts := MakeServeOptions(sOpts...)
+	s := &server{
+		maxUploadBytes: opts.MaxUploadBytes(),
+		maxPixels:      opts.MaxPixels(),
+		sem:            make(chan struct{}, or.Int(opts.MaxConcurrent(), runtime.NumCPU())),
+	}
+	s.threads = intgr.Max(1, runtime.NumCPU()/cap(s.sem))
+	if s.maxUploadBytes == 0 {
+		s.maxUploadBytes = defaultMaxUploadBytes
+	}
+	if s.maxPixels == 0 {
+		s.maxPixels = defaultMaxPixels
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/convert", s.handleConvert)
+	mux.HandleFunc("/converters", s.handleConverters)
+	return mux
+}
+
+// Serve serves the converters on addr, e.g. ":8080"; see MakeHandler.
+// Requests must be read within a time limit, so slow clients can't hold
+// connections open indefinitely.
+func Serve(addr string, sOpts ...ServeOption) error {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           MakeHandler(sOpts...),
+		ReadHeaderTimeout: serveReadHeaderTimeout,
+		ReadTimeout:       serveReadTimeout,
+	}
+	log.Printf("serving on %s", addr)
+	return srv.ListenAndServe()
+}
+
+type converterJSON struct {
+	Name   string   `json:"name"`
+	Params []string `json:"params"`
+}
+
+type paramJSON struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc"`
+}
+
+type convertersJSON struct {
+	Converters []converterJSON `json:"converters"`
+	// Params are the docs of all the parameters.
+	Params []paramJSON `json:"params"`
+}
+
+func (s *server) handleConverters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	res := convertersJSON{Params: []paramJSON{
+		{Name: "converter", Doc: "name of the converter, or converters chained with |"},
+		{Name: "format", Doc: "extension of the format of the result, e.g. .png, .svg or .txt; defaults to that of the converter's output file"},
+	}}
+	names := AllConverterNames()
+	sort.Strings(names)
+	for _, name := range names {
+		params := append(append([]string{}, converterParams(globalReg.Get(name))...), commonParams...)
+		res.Converters = append(res.Converters, converterJSON{Name: name, Params: params})
+	}
+	for _, p := range serveParams {
+		res.Params = append(res.Params, paramJSON{Name: p.name, Doc: p.doc})
+	}
+	for _, name := range animateRangeParams {
+		res.Params = append(res.Params, paramJSON{Name: name, Doc: "range of block sizes of animations"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *server) handleConvert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	conv, err := globalReg.Lookup(query.Get("converter"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cOpts, err := parseServeParams(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts := MakeConvertOptions(append(cOpts, ConvertAnimateThreads(s.threads), ConvertThreads(s.threads))...)
+
+	upload, err := s.readUpload(r)
+	if errors.Is(err, errUploadTooLarge) {
+		http.Error(w, errors.Errorf("upload larger than %d bytes", s.maxUploadBytes).Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// Check the size before decoding, which allocates the pixels.
+	config, _, err := image.DecodeConfig(bytes.NewReader(upload))
+	if err != nil {
+		http.Error(w, errors.Errorf("decoding image: %v", err).Error(), http.StatusBadRequest)
+		return
+	}
+	if pixels := int64(config.Width) * int64(config.Height); pixels > s.maxPixels {
+		http.Error(w, errors.Errorf("image of %dx%d is over the limit of %d pixels", config.Width, config.Height, s.maxPixels).Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	// Take a slot only once the upload is in, so slow uploads don't hold them.
+	select {
+	case s.sem <- struct{}{}:
+		defer func() { <-s.sem }()
+	default:
+		http.Error(w, "too many conversions in flight, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	inputImage, format, err := decodeReader(bytes.NewReader(upload))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pal, err := paletteFor(inputImage, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := convertImage(inputImage, "", conv, pal, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ext := strings.ToLower(query.Get("format"))
+	if ext == "" {
+		ext = defaultFormat(conv, format, opts)
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	var out bytes.Buffer
+	if err := encodeTo(&out, ext, res); err != nil {
+		http.Error(w, errors.Errorf("encoding %s: %v", ext, err).Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", contentType(ext))
+	w.Header().Set("Content-Length", strconv.Itoa(out.Len()))
+	w.Write(out.Bytes())
+}
+
+// readUpload returns the image in the body of r, either the "image" field of
+// a multipart form or the whole body.
+func (s *server) readUpload(r *http.Request) ([]byte, error) {
+	body := &maxBytesReader{r: r.Body, n: s.maxUploadBytes}
+	mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return io.ReadAll(body)
+	}
+	if params["boundary"] == "" {
+		return nil, errors.Errorf("multipart upload without a boundary")
+	}
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.Errorf("no image field in multipart upload")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "image" {
+			return io.ReadAll(part)
+		}
+	}
+}
+
+// maxBytesReader fails with errUploadTooLarge once more than n bytes are read.
+type maxBytesReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return 0, errUploadTooLarge
+	}
+	return n, err
+}
+
+var contentTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+	".txt":  "text/plain; charset=utf-8",
+	".ans":  "text/plain; charset=utf-8",
+}
+
+func contentType(ext string) string {
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	return "application/octet-stream"
+}
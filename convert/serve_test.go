@@ -0,0 +1,185 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func pngBytes(t *testing.T, img image.Image) []byte {
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatalf("encoding png: %v", err)
+	}
+	return b.Bytes()
+}
+
+func TestServeConvertRaw(t *testing.T) {
+	srv := httptest.NewServer(MakeHandler())
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/convert?converter=block_mean&block_size=4", "image/png", bytes.NewReader(pngBytes(t, randomImage(16, 8, 1))))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("content type = %q, want image/png", ct)
+	}
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Errorf("result is %dx%d, want 16x8", b.Dx(), b.Dy())
+	}
+}
+
+func TestServeConvertMultipartText(t *testing.T) {
+	srv := httptest.NewServer(MakeHandler())
+	defer srv.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("image", "in.png")
+	fw.Write(pngBytes(t, image.NewGray(image.Rect(0, 0, 4, 8))))
+	mw.Close()
+	resp, err := http.Post(srv.URL+"/convert?converter=ascii&block_size=2", mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	var got bytes.Buffer
+	got.ReadFrom(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, got.String())
+	}
+	if want := "  \n  \n"; got.String() != want {
+		t.Errorf("body = %q, want %q", got.String(), want)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	srv := httptest.NewServer(MakeHandler(ServeMaxUploadBytes(100)))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		name, query string
+		body        []byte
+		want        int
+	}{
+		{"unknown converter", "converter=nope", pngBytes(t, randomImage(4, 4, 1)), http.StatusBadRequest},
+		{"bad param", "converter=block_mean&block_size=x", pngBytes(t, randomImage(4, 4, 1)), http.StatusBadRequest},
+		{"not an image", "converter=block_mean", []byte("hello"), http.StatusBadRequest},
+		{"too large", "converter=block_mean", pngBytes(t, randomImage(64, 64, 1)), http.StatusRequestEntityTooLarge},
+		{"too many frames", "converter=animate_block&animate_block_size_start=1&animate_block_size_end=10000", pngBytes(t, image.NewGray(image.Rect(0, 0, 1, 1))), http.StatusBadRequest},
+	} {
+		resp, err := http.Post(srv.URL+"/convert?"+test.query, "image/png", bytes.NewReader(test.body))
+		if err != nil {
+			t.Fatalf("%s: post: %v", test.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("%s: status = %d, want %d", test.name, resp.StatusCode, test.want)
+		}
+	}
+}
+
+func TestServeMaxPixels(t *testing.T) {
+	srv := httptest.NewServer(MakeHandler(ServeMaxPixels(100)))
+	defer srv.Close()
+
+	for _, test := range []struct {
+		w, h int
+		want int
+	}{
+		{10, 10, http.StatusOK},
+		{11, 10, http.StatusRequestEntityTooLarge},
+	} {
+		resp, err := http.Post(srv.URL+"/convert?converter=block_mean", "image/png", bytes.NewReader(pngBytes(t, image.NewGray(image.Rect(0, 0, test.w, test.h)))))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.want {
+			t.Errorf("%dx%d: status = %d, want %d", test.w, test.h, resp.StatusCode, test.want)
+		}
+	}
+}
+
+func TestServeAnimateParams(t *testing.T) {
+	cOpts, err := parseServeParams(map[string][]string{"animate_threads": {"100000"}, "animate_block_size_end": {"4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MakeConvertOptions(cOpts...).AnimateThreads(); got != 0 {
+		t.Errorf("animate threads = %d, want them left to the server", got)
+	}
+	for _, test := range []struct {
+		start, end, step string
+		ok               bool
+	}{
+		{"1", "150", "1", true},
+		{"1", "151", "1", false},
+		{"1", "10000", "100", true},
+		{"1", "10000", "10", false},
+	} {
+		_, err := parseServeParams(map[string][]string{
+			"animate_block_size_start": {test.start},
+			"animate_block_size_end":   {test.end},
+			"animate_block_size_step":  {test.step},
+		})
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("range %s-%s by %s: err = %v, want ok %v", test.start, test.end, test.step, err, test.ok)
+		}
+	}
+}
+
+func TestServeConcurrencyCap(t *testing.T) {
+	s := &server{maxUploadBytes: defaultMaxUploadBytes, maxPixels: defaultMaxPixels, sem: make(chan struct{}, 1)}
+	// Take the only slot, as a conversion in flight would.
+	s.sem <- struct{}{}
+	w := httptest.NewRecorder()
+	s.handleConvert(w, httptest.NewRequest(http.MethodPost, "/convert?converter=block_mean", bytes.NewReader(pngBytes(t, randomImage(4, 4, 1)))))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	// Uploads are read and checked before taking a slot.
+	w = httptest.NewRecorder()
+	s.handleConvert(w, httptest.NewRequest(http.MethodPost, "/convert?converter=block_mean", strings.NewReader("")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status of an empty upload = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestServeConverters(t *testing.T) {
+	srv := httptest.NewServer(MakeHandler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/converters")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	defer resp.Body.Close()
+	var got convertersJSON
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("decoding: %v", err)
+	}
+	if len(got.Converters) != len(AllConverterNames()) {
+		t.Errorf("got %d converters, want %d", len(got.Converters), len(AllConverterNames()))
+	}
+	for _, c := range got.Converters {
+		if c.Name == "block_median" && c.Params[0] != "block_size" {
+			t.Errorf("block_median params = %v, want block_size first", c.Params)
+		}
+	}
+}
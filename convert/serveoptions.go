@@ -0,0 +1,66 @@
+package convert
+
+//go:generate genopts --prefix=Serve --outfile=serveoptions.go "maxUploadBytes:int64" "maxConcurrent:int" "maxPixels:int64"
+
+type ServeOption func(*serveOptionImpl)
+
+type ServeOptions interface {
+	MaxUploadBytes() int64
+	MaxConcurrent() int
+	MaxPixels() int64
+}
+
+func ServeMaxUploadBytes(maxUploadBytes int64) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxUploadBytes = maxUploadBytes
+	}
+}
+func ServeMaxUploadBytesFlag(maxUploadBytes *int64) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxUploadBytes = *maxUploadBytes
+	}
+}
+
+func ServeMaxConcurrent(maxConcurrent int) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxConcurrent = maxConcurrent
+	}
+}
+func ServeMaxConcurrentFlag(maxConcurrent *int) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxConcurrent = *maxConcurrent
+	}
+}
+
+func ServeMaxPixels(maxPixels int64) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxPixels = maxPixels
+	}
+}
+func ServeMaxPixelsFlag(maxPixels *int64) ServeOption {
+	return func(opts *serveOptionImpl) {
+		opts.maxPixels = *maxPixels
+	}
+}
+
+type serveOptionImpl struct {
+	maxUploadBytes int64
+	maxConcurrent  int
+	maxPixels      int64
+}
+
+func (s *serveOptionImpl) MaxUploadBytes() int64 { return s.maxUploadBytes }
+func (s *serveOptionImpl) MaxConcurrent() int    { return s.maxConcurrent }
+func (s *serveOptionImpl) MaxPixels() int64      { return s.maxPixels }
+
+func makeServeOptionImpl(opts ...ServeOption) *serveOptionImpl {
+	res := &serveOptionImpl{}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func MakeServeOptions(opts ...ServeOption) ServeOptions {
+	return makeServeOptionImpl(opts...)
+}
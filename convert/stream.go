@@ -0,0 +1,121 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConvertImage converts img with the converter named converter, which may be a
+// pipeline like "block_median|websafe_pixelated", and then resizes the result
+// and reduces it to a palette as requested in opts. Nothing is written; the
+// file options, e.g. ConvertOutputFile, are ignored.
+func ConvertImage(img image.Image, converter string, cOpts ...ConvertOption) (ConvertResult, error) {
+	opts := MakeConvertOptions(cOpts...)
+	conv, err := globalReg.Lookup(converter)
+	if err != nil {
+		return nil, err
+	}
+	pal, err := paletteFor(img, opts)
+	if err != nil {
+		return nil, err
+	}
+	return convertImage(img, "", conv, pal, opts)
+}
+
+// ConvertReader is ConvertImage for an encoded image, whose format is sniffed
+// from its contents.
+func ConvertReader(r io.Reader, converter string, cOpts ...ConvertOption) (ConvertResult, error) {
+	img, _, err := decodeReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ConvertImage(img, converter, cOpts...)
+}
+
+// ConvertWriter converts the image encoded in r like ConvertReader and writes
+// the result to w in format, the extension of a file it could be written to,
+// e.g. ".png", ".svg" or ".scr". An empty format is the one Convert would
+// write, e.g. that of the input for most converters.
+func ConvertWriter(w io.Writer, format string, r io.Reader, converter string, cOpts ...ConvertOption) error {
+	img, imgFormat, err := decodeReader(r)
+	if err != nil {
+		return err
+	}
+	opts := MakeConvertOptions(cOpts...)
+	conv, err := globalReg.Lookup(converter)
+	if err != nil {
+		return err
+	}
+	pal, err := paletteFor(img, opts)
+	if err != nil {
+		return err
+	}
+	res, err := convertImage(img, "", conv, pal, opts)
+	if err != nil {
+		return err
+	}
+	if format == "" {
+		format = defaultFormat(conv, imgFormat, opts)
+	}
+	return Encode(w, format, res)
+}
+
+// Encode writes res to w in format, the extension of a file it could be
+// written to, e.g. ".png", ".svg", ".txt" or ".scr". Of native formats with
+// companion files only the main file is written.
+func Encode(w io.Writer, format string, res ConvertResult) error {
+	ext := strings.ToLower(format)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return encodeTo(w, ext, res)
+}
+
+// convertImage runs conv on inputImage, named input, and post-processes the result.
+func convertImage(inputImage image.Image, input string, conv Converter, pal color.Palette, opts ConvertOptions) (ConvertResult, error) {
+	start := time.Now()
+
+	res, err := conv.Convert(input, inputImage, opts)
+	if err != nil {
+		return nil, errors.Errorf("converting image: %v", err)
+	}
+	if res == nil {
+		return nil, errors.Errorf("converting image returned nil image")
+	}
+	res, err = postProcess(res, conv, pal, opts)
+	if err != nil {
+		return nil, err
+	}
+	return withDuration(res, time.Since(start)), nil
+}
+
+// decodeReader decodes an image in any of the registered formats, returning
+// the name of the format, e.g. "png".
+func decodeReader(r io.Reader) (image.Image, string, error) {
+	img, format, err := image.Decode(r)
+	if err != nil {
+		return nil, "", errors.Errorf("decoding image: %v", err)
+	}
+	return img, format, nil
+}
+
+// formatExt returns the file extension for an image format name returned by
+// image.Decode.
+func formatExt(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// defaultFormat is the extension of the file Convert would write converting
+// an image in imgFormat with conv.
+func defaultFormat(conv Converter, imgFormat string, opts ConvertOptions) string {
+	return path.Ext(conv.OutputFileName("image"+formatExt(imgFormat), opts))
+}
@@ -0,0 +1,62 @@
+package convert
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestConvertWriterSniffsFormat(t *testing.T) {
+	var in bytes.Buffer
+	if err := gif.Encode(&in, randomImage(8, 8, 2), nil); err != nil {
+		t.Fatalf("encoding gif: %v", err)
+	}
+	var out bytes.Buffer
+	if err := ConvertWriter(&out, ".png", &in, "block_mean", ConvertBlockSize(4)); err != nil {
+		t.Fatalf("ConvertWriter: %v", err)
+	}
+	img, format, err := image.Decode(&out)
+	if err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if format != "png" || img.Bounds().Dx() != 8 {
+		t.Errorf("result is a %dpx wide %s, want an 8px wide png", img.Bounds().Dx(), format)
+	}
+}
+
+func TestConvertImage(t *testing.T) {
+	res, err := ConvertImage(randomImage(8, 8, 3), "block_median|ascii", ConvertBlockSize(4))
+	if err != nil {
+		t.Fatalf("ConvertImage: %v", err)
+	}
+	// 2 blocks of 4x8 make a line of 2 characters.
+	if got := res.Text(); len(got) != 3 || got[2] != '\n' {
+		t.Errorf("text = %q, want 2 characters and a newline", got)
+	}
+	if _, err := ConvertImage(randomImage(8, 8, 3), "nope"); err == nil {
+		t.Errorf("ConvertImage with an unknown converter succeeded")
+	}
+}
+
+func TestConvertNamesOutputsAfterSniffedFormat(t *testing.T) {
+	dir := t.TempDir()
+	input := path.Join(dir, "in.dat")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, randomImage(8, 8, 4))
+	f.Close()
+
+	outputs, err := Convert(input, ConvertConverters([]string{"block_mean"}), ConvertBlockSize(4))
+	if err != nil {
+		t.Fatalf("Convert: %v", err)
+	}
+	if want := path.Join(dir, "in-block_mean-0004.png"); len(outputs) != 1 || outputs[0] != want {
+		t.Errorf("outputs = %v, want [%s]", outputs, want)
+	}
+}
@@ -0,0 +1,122 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"path"
+	"strings"
+
+	"github.com/spudtrooper/goutil/or"
+)
+
+// asciiRamp goes from the sparsest to the densest character, so bright blocks
+// are dense on the usual dark terminal background.
+const asciiRamp = " .:-=+*#%@"
+
+// ansiReset restores the default colors at the end of each line of ANSI output.
+const ansiReset = "\x1b[0m"
+
+// textBlocks aggregates inputImage into blocks twice as high as they are wide,
+// since that's roughly the shape of a terminal character cell.
+func textBlocks(inputImage image.Image, opts ConvertOptions) [][]color.Color {
+	aggr := meanAggr(opts)
+	if opts.TextMedian() {
+		aggr = medianAggr(opts)
+	}
+	inc := or.Int(opts.BlockSize(), 10)
+	return rectBlockColors(inputImage, inc, 2*inc, aggr, opts.Threads())
+}
+
+func asciiChar(c color.Color) byte {
+	y := color.GrayModel.Convert(c).(color.Gray).Y
+	return asciiRamp[int(y)*len(asciiRamp)/256]
+}
+
+// ansi256Palette is the part of the xterm 256 color palette that doesn't
+// depend on the terminal's theme: the 6x6x6 color cube at 16-231 and the
+// grays at 232-255.
+var ansi256Palette = func() color.Palette {
+	levels := []uint8{0, 95, 135, 175, 215, 255}
+	var p color.Palette
+	for _, r := range levels {
+		for _, g := range levels {
+			for _, b := range levels {
+				p = append(p, color.RGBA{r, g, b, 255})
+			}
+		}
+	}
+	for i := 0; i < 24; i++ {
+		v := uint8(8 + 10*i)
+		p = append(p, color.RGBA{v, v, v, 255})
+	}
+	return p
+}()
+
+// ansi256Index returns the xterm color number nearest to c in space.
+func ansi256Index(c color.Color, space colorSpace) int {
+	return 16 + nearestIn(space, c, ansi256Palette)
+}
+
+func textConvert(inputImage image.Image, opts ConvertOptions, cell func(c color.Color) string, lineEnd string) ConvertResult {
+	var b strings.Builder
+	for _, row := range textBlocks(inputImage, opts) {
+		for _, c := range row {
+			b.WriteString(cell(c))
+		}
+		b.WriteString(lineEnd)
+		b.WriteString("\n")
+	}
+	return makeTextConvertResult(b.String())
+}
+
+func asciiConvert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	return textConvert(inputImage, opts, func(c color.Color) string {
+		return string(asciiChar(c))
+	}, ""), nil
+}
+
+// The ANSI converters paint each block as a space on a colored background.
+
+func ansi256Convert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	return textConvert(inputImage, opts, func(c color.Color) string {
+		return fmt.Sprintf("\x1b[48;5;%dm ", ansi256Index(c, colorSpaceOf(opts)))
+	}, ansiReset), nil
+}
+
+func ansiTrueColorConvert(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	return textConvert(inputImage, opts, func(c color.Color) string {
+		r, g, b, _ := c.RGBA()
+		return fmt.Sprintf("\x1b[48;2;%d;%d;%dm ", r>>8, g>>8, b>>8)
+	}, ansiReset), nil
+}
+
+// textConverter writes text instead of an image, to a file with ext.
+type textConverter struct {
+	baseConverter
+	ext string
+}
+
+func (c *textConverter) OutputFileName(input string, opts ConvertOptions) string {
+	ext := path.Ext(input)
+	base := strings.Replace(path.Base(input), ext, "", 1)
+	return fmt.Sprintf("%s-%s-%04d%s", base, c.Name(), opts.BlockSize(), c.ext)
+}
+
+func init() {
+	globalReg.Register(&textConverter{
+		baseConverter{
+			name: "ascii",
+			conv: asciiConvert,
+		}, ".txt"})
+	globalReg.Register(&textConverter{
+		baseConverter{
+			name: "ansi256",
+			conv: ansi256Convert,
+		}, ".ans"})
+	globalReg.Register(&textConverter{
+		baseConverter{
+			name: "ansitruecolor",
+			conv: ansiTrueColorConvert,
+		}, ".ans"})
+}
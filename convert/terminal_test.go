@@ -0,0 +1,47 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestASCIIConvert(t *testing.T) {
+	// White on the left, black on the right; blocks are 2x4.
+	img := image.NewRGBA(image.Rect(0, 0, 4, 8))
+	draw.Draw(img, image.Rect(0, 0, 2, 8), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(2, 0, 4, 8), image.Black, image.Point{}, draw.Src)
+	res, err := asciiConvert("", img, MakeConvertOptions(ConvertBlockSize(2)))
+	if err != nil {
+		t.Fatalf("asciiConvert: %v", err)
+	}
+	if got, want := res.Text(), "@ \n@ \n"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if res.Image() != nil {
+		t.Errorf("text converter returned an image")
+	}
+}
+
+func TestANSIConvert(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 4))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	opts := MakeConvertOptions(ConvertBlockSize(2))
+	for _, test := range []struct {
+		name string
+		conv func(string, image.Image, ConvertOptions) (ConvertResult, error)
+		want string
+	}{
+		{"ansi256", ansi256Convert, "\x1b[48;5;196m \x1b[0m\n"},
+		{"ansitruecolor", ansiTrueColorConvert, "\x1b[48;2;255;0;0m \x1b[0m\n"},
+	} {
+		res, err := test.conv("", img, opts)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if got := res.Text(); got != test.want {
+			t.Errorf("%s: text = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
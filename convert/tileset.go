@@ -0,0 +1,332 @@
+package convert
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/goutil/io"
+	"github.com/spudtrooper/goutil/or"
+)
+
+// Tiled stores flips in the high bits of global tile IDs.
+const (
+	tiledFlipH = 1 << 31
+	tiledFlipV = 1 << 30
+)
+
+// tileset is an image sliced into a grid of tiles where identical tiles,
+// including ones that are mirror images of each other, are stored once.
+type tileset struct {
+	tileSize      int
+	width, height int // in tiles
+	tiles         []*image.RGBA
+	// Per cell of the grid, row-major, the index into tiles and how to flip it.
+	cells []tileRef
+}
+
+type tileRef struct {
+	tile         int
+	flipH, flipV bool
+}
+
+// gid returns the global tile ID Tiled uses for r, in a tileset starting at 1.
+func (r tileRef) gid() uint32 {
+	gid := uint32(r.tile + 1)
+	if r.flipH {
+		gid |= tiledFlipH
+	}
+	if r.flipV {
+		gid |= tiledFlipV
+	}
+	return gid
+}
+
+func flipTile(t *image.RGBA, flipH, flipV bool) *image.RGBA {
+	b := t.Bounds()
+	res := image.NewRGBA(b)
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			sx, sy := x, y
+			if flipH {
+				sx = b.Dx() - 1 - x
+			}
+			if flipV {
+				sy = b.Dy() - 1 - y
+			}
+			res.SetRGBA(x, y, t.RGBAAt(sx, sy))
+		}
+	}
+	return res
+}
+
+// makeTileset slices img into tileSize x tileSize tiles. Tiles on the right
+// and bottom edges are padded with transparent pixels.
+func makeTileset(img image.Image, tileSize int) *tileset {
+	b := img.Bounds()
+	ts := &tileset{
+		tileSize: tileSize,
+		width:    (b.Dx() + tileSize - 1) / tileSize,
+		height:   (b.Dy() + tileSize - 1) / tileSize,
+	}
+	seen := map[string]int{}
+	for ty := 0; ty < ts.height; ty++ {
+		for tx := 0; tx < ts.width; tx++ {
+			t := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+			r := image.Rect(tx*tileSize, ty*tileSize, (tx+1)*tileSize, (ty+1)*tileSize).Add(b.Min).Intersect(b)
+			draw.Draw(t, r.Sub(b.Min).Sub(image.Pt(tx*tileSize, ty*tileSize)), img, r.Min, draw.Src)
+
+			ref, found := tileRef{}, false
+			for _, flip := range []struct{ h, v bool }{{false, false}, {true, false}, {false, true}, {true, true}} {
+				if i, ok := seen[string(flipTile(t, flip.h, flip.v).Pix)]; ok {
+					ref, found = tileRef{i, flip.h, flip.v}, true
+					break
+				}
+			}
+			if !found {
+				ref = tileRef{tile: len(ts.tiles)}
+				seen[string(t.Pix)] = ref.tile
+				ts.tiles = append(ts.tiles, t)
+			}
+			ts.cells = append(ts.cells, ref)
+		}
+	}
+	return ts
+}
+
+func (ts *tileset) columns() int {
+	return int(math.Ceil(math.Sqrt(float64(len(ts.tiles)))))
+}
+
+// image lays the tiles out in a grid of columns() tiles per row, or is empty
+// if there are no tiles, e.g. of an empty image.
+func (ts *tileset) image() *image.RGBA {
+	if len(ts.tiles) == 0 {
+		return image.NewRGBA(image.Rectangle{})
+	}
+	cols := ts.columns()
+	rows := (len(ts.tiles) + cols - 1) / cols
+	res := image.NewRGBA(image.Rect(0, 0, cols*ts.tileSize, rows*ts.tileSize))
+	for i, t := range ts.tiles {
+		at := image.Pt((i%cols)*ts.tileSize, (i/cols)*ts.tileSize)
+		draw.Draw(res, t.Bounds().Add(at), t, image.Point{}, draw.Src)
+	}
+	return res
+}
+
+// csv returns the grid of Tiled global tile IDs, one row per line.
+func (ts *tileset) csv() string {
+	var lines []string
+	for y := 0; y < ts.height; y++ {
+		var row []string
+		for x := 0; x < ts.width; x++ {
+			row = append(row, fmt.Sprintf("%d", ts.cells[y*ts.width+x].gid()))
+		}
+		lines = append(lines, strings.Join(row, ","))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+type tiledJSONTileset struct {
+	FirstGID    int    `json:"firstgid"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	ImageWidth  int    `json:"imagewidth"`
+	ImageHeight int    `json:"imageheight"`
+	TileWidth   int    `json:"tilewidth"`
+	TileHeight  int    `json:"tileheight"`
+	TileCount   int    `json:"tilecount"`
+	Columns     int    `json:"columns"`
+	Margin      int    `json:"margin"`
+	Spacing     int    `json:"spacing"`
+}
+
+type tiledJSONLayer struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Width   int      `json:"width"`
+	Height  int      `json:"height"`
+	X       int      `json:"x"`
+	Y       int      `json:"y"`
+	Opacity float64  `json:"opacity"`
+	Visible bool     `json:"visible"`
+	Data    []uint32 `json:"data"`
+}
+
+type tiledJSONMap struct {
+	Type         string             `json:"type"`
+	Version      string             `json:"version"`
+	Orientation  string             `json:"orientation"`
+	RenderOrder  string             `json:"renderorder"`
+	Width        int                `json:"width"`
+	Height       int                `json:"height"`
+	TileWidth    int                `json:"tilewidth"`
+	TileHeight   int                `json:"tileheight"`
+	Infinite     bool               `json:"infinite"`
+	NextLayerID  int                `json:"nextlayerid"`
+	NextObjectID int                `json:"nextobjectid"`
+	Layers       []tiledJSONLayer   `json:"layers"`
+	Tilesets     []tiledJSONTileset `json:"tilesets"`
+}
+
+// json returns a Tiled JSON map that refers to the tileset image tilesetImage.
+func (ts *tileset) json(name, tilesetImage string) ([]byte, error) {
+	img := ts.image()
+	var data []uint32
+	for _, c := range ts.cells {
+		data = append(data, c.gid())
+	}
+	m := tiledJSONMap{
+		Type:         "map",
+		Version:      "1.10",
+		Orientation:  "orthogonal",
+		RenderOrder:  "right-down",
+		Width:        ts.width,
+		Height:       ts.height,
+		TileWidth:    ts.tileSize,
+		TileHeight:   ts.tileSize,
+		NextLayerID:  2,
+		NextObjectID: 1,
+		Layers: []tiledJSONLayer{{
+			ID: 1, Name: "Tiles", Type: "tilelayer",
+			Width: ts.width, Height: ts.height,
+			Opacity: 1, Visible: true,
+			Data: data,
+		}},
+		Tilesets: []tiledJSONTileset{{
+			FirstGID: 1, Name: name,
+			Image: tilesetImage, ImageWidth: img.Bounds().Dx(), ImageHeight: img.Bounds().Dy(),
+			TileWidth: ts.tileSize, TileHeight: ts.tileSize,
+			TileCount: len(ts.tiles), Columns: ts.columns(),
+		}},
+	}
+	return json.MarshalIndent(m, "", "  ")
+}
+
+type tmxImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type tmxTileset struct {
+	FirstGID   int      `xml:"firstgid,attr"`
+	Name       string   `xml:"name,attr"`
+	TileWidth  int      `xml:"tilewidth,attr"`
+	TileHeight int      `xml:"tileheight,attr"`
+	TileCount  int      `xml:"tilecount,attr"`
+	Columns    int      `xml:"columns,attr"`
+	Image      tmxImage `xml:"image"`
+}
+
+type tmxData struct {
+	Encoding string `xml:"encoding,attr"`
+	CSV      string `xml:",chardata"`
+}
+
+type tmxLayer struct {
+	ID     int     `xml:"id,attr"`
+	Name   string  `xml:"name,attr"`
+	Width  int     `xml:"width,attr"`
+	Height int     `xml:"height,attr"`
+	Data   tmxData `xml:"data"`
+}
+
+type tmxMap struct {
+	XMLName      xml.Name   `xml:"map"`
+	Version      string     `xml:"version,attr"`
+	Orientation  string     `xml:"orientation,attr"`
+	RenderOrder  string     `xml:"renderorder,attr"`
+	Width        int        `xml:"width,attr"`
+	Height       int        `xml:"height,attr"`
+	TileWidth    int        `xml:"tilewidth,attr"`
+	TileHeight   int        `xml:"tileheight,attr"`
+	Infinite     int        `xml:"infinite,attr"`
+	NextLayerID  int        `xml:"nextlayerid,attr"`
+	NextObjectID int        `xml:"nextobjectid,attr"`
+	Tileset      tmxTileset `xml:"tileset"`
+	Layer        tmxLayer   `xml:"layer"`
+}
+
+// tmx returns a Tiled TMX map that refers to the tileset image tilesetImage.
+func (ts *tileset) tmx(name, tilesetImage string) ([]byte, error) {
+	img := ts.image()
+	m := tmxMap{
+		Version:      "1.10",
+		Orientation:  "orthogonal",
+		RenderOrder:  "right-down",
+		Width:        ts.width,
+		Height:       ts.height,
+		TileWidth:    ts.tileSize,
+		TileHeight:   ts.tileSize,
+		NextLayerID:  2,
+		NextObjectID: 1,
+		Tileset: tmxTileset{
+			FirstGID: 1, Name: name,
+			TileWidth: ts.tileSize, TileHeight: ts.tileSize,
+			TileCount: len(ts.tiles), Columns: ts.columns(),
+			Image: tmxImage{Source: tilesetImage, Width: img.Bounds().Dx(), Height: img.Bounds().Dy()},
+		},
+		Layer: tmxLayer{
+			ID: 1, Name: "Tiles", Width: ts.width, Height: ts.height,
+			Data: tmxData{Encoding: "csv", CSV: "\n" + ts.csv()},
+		},
+	}
+	b, err := xml.MarshalIndent(m, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// writeTileset writes the tileset of img next to output as <base>-tileset.png
+// and the tilemap as <base>-tilemap.csv, .json and .tmx.
+func writeTileset(output string, img image.Image, opts ConvertOptions) error {
+	tileSize := or.Int(opts.TileSize(), or.Int(opts.BlockSize(), 10))
+	ts := makeTileset(img, tileSize)
+	if len(ts.tiles) == 0 {
+		return errors.Errorf("%v image has no tiles", img.Bounds())
+	}
+
+	base := strings.TrimSuffix(output, path.Ext(output))
+	name := path.Base(base)
+	tilesetImage := base + "-tileset.png"
+	jsonMap, err := ts.json(name, path.Base(tilesetImage))
+	if err != nil {
+		return errors.Errorf("making JSON tilemap: %v", err)
+	}
+	tmxMap, err := ts.tmx(name, path.Base(tilesetImage))
+	if err != nil {
+		return errors.Errorf("making TMX tilemap: %v", err)
+	}
+	tilemaps := map[string][]byte{
+		base + "-tilemap.csv":  []byte(ts.csv()),
+		base + "-tilemap.json": jsonMap,
+		base + "-tilemap.tmx":  tmxMap,
+	}
+
+	for _, f := range []string{tilesetImage, base + "-tilemap.csv", base + "-tilemap.json", base + "-tilemap.tmx"} {
+		if !mayOverwrite(f, opts) && io.FileExists(f) {
+			return errors.Errorf("%s exists. pass --force to write anyway", f)
+		}
+	}
+	if err := encodeImage(tilesetImage, ts.image()); err != nil {
+		return err
+	}
+	for f, b := range tilemaps {
+		if err := os.WriteFile(f, b, 0644); err != nil {
+			return errors.Errorf("writing %s: %v", f, err)
+		}
+	}
+
+	log.Printf("wrote %d unique %dx%d tiles for a %dx%d tilemap to %s", len(ts.tiles), tileSize, tileSize, ts.width, ts.height, tilesetImage)
+	return nil
+}
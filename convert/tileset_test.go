@@ -0,0 +1,75 @@
+package convert
+
+import (
+	"encoding/xml"
+	"image"
+	"image/color"
+	"path"
+	"testing"
+)
+
+func TestTilesetDedupesFlippedTiles(t *testing.T) {
+	// Four 2x2 tiles: one with a red top left pixel, its horizontal mirror,
+	// its vertical mirror and a plain one. The last column is cut off.
+	img := image.NewRGBA(image.Rect(0, 0, 7, 2))
+	red := color.RGBA{255, 0, 0, 255}
+	img.Set(0, 0, red)
+	img.Set(3, 0, red)
+	img.Set(4, 1, red)
+	ts := makeTileset(img, 2)
+
+	if ts.width != 4 || ts.height != 1 {
+		t.Fatalf("size = %dx%d tiles, want 4x1", ts.width, ts.height)
+	}
+	if got := len(ts.tiles); got != 2 {
+		t.Fatalf("unique tiles = %d, want 2", got)
+	}
+	want := []tileRef{{0, false, false}, {0, true, false}, {0, false, true}, {1, false, false}}
+	for i, w := range want {
+		if ts.cells[i] != w {
+			t.Errorf("cell %d = %+v, want %+v", i, ts.cells[i], w)
+		}
+	}
+	if got, want := ts.csv(), "1,2147483649,1073741825,2\n"; got != want {
+		t.Errorf("csv = %q, want %q", got, want)
+	}
+	// The padding of the cut off tile is transparent.
+	if a := ts.tiles[1].RGBAAt(1, 0).A; a != 0 {
+		t.Errorf("padding alpha = %d, want 0", a)
+	}
+}
+
+func TestTilesetTMXIsValidXML(t *testing.T) {
+	ts := makeTileset(randomImage(20, 10, 13), 5)
+	b, err := ts.tmx("test", "test-tileset.png")
+	if err != nil {
+		t.Fatalf("tmx: %v", err)
+	}
+	var m tmxMap
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshaling tmx: %v", err)
+	}
+	if m.Width != 4 || m.Height != 2 || m.Tileset.TileCount != len(ts.tiles) {
+		t.Errorf("tmx = %dx%d with %d tiles, want 4x2 with %d", m.Width, m.Height, m.Tileset.TileCount, len(ts.tiles))
+	}
+}
+
+func TestTilesetOfEmptyImage(t *testing.T) {
+	ts := makeTileset(image.NewRGBA(image.Rect(0, 0, 0, 0)), 8)
+	if got := len(ts.tiles); got != 0 {
+		t.Fatalf("unique tiles = %d, want 0", got)
+	}
+	if b := ts.image().Bounds(); !b.Empty() {
+		t.Errorf("image bounds = %v, want empty", b)
+	}
+	if _, err := ts.tmx("test", "test-tileset.png"); err != nil {
+		t.Errorf("tmx: %v", err)
+	}
+	if _, err := ts.json("test", "test-tileset.png"); err != nil {
+		t.Errorf("json: %v", err)
+	}
+	output := path.Join(t.TempDir(), "empty.png")
+	if err := writeTileset(output, image.NewRGBA(image.Rect(0, 0, 0, 0)), MakeConvertOptions(ConvertTileSize(8))); err == nil {
+		t.Errorf("writeTileset of an empty image succeeded")
+	}
+}
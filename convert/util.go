@@ -1,13 +1,231 @@
 package convert
 
 import (
+	"fmt"
 	"image/color"
+	"math"
+	"strings"
 
 	"github.com/jyotiska/go-webcolors"
+	"github.com/pkg/errors"
+	"github.com/spudtrooper/goutil/or"
 )
 
 func colorName(c color.Color) string {
 	r, g, b, _ := c.RGBA()
-	name := webcolors.RGBToName([]int{int(r), int(g), int(b)}, "html4")
+	name := webcolors.RGBToName([]int{int(r >> 8), int(g >> 8), int(b >> 8)}, "html4")
 	return name
 }
+
+// colorHex returns c as #rrggbb, ignoring alpha.
+func colorHex(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+// rgba8 converts the alpha-premultiplied 16-bit components returned by
+// color.Color.RGBA to a color.RGBA, like color.RGBAModel.
+func rgba8(r, g, b, a uint32) color.RGBA {
+	return color.RGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: uint8(a >> 8)}
+}
+
+// clamp8 clamps v to [0, max].
+func clamp8(v int, max uint8) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > int(max) {
+		return max
+	}
+	return uint8(v)
+}
+
+// coords returns c, ignoring alpha, in s.
+func (s colorSpace) coords(c color.Color) (float64, float64, float64) {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return s.fromSRGB(float64(n.R), float64(n.G), float64(n.B))
+}
+
+// sqDiffIn is the squared euclidean distance between a and b in space; in
+// sRGB that of sqDiffRGB.
+func sqDiffIn(space colorSpace, a, b color.Color) float64 {
+	if space == colorSpaceSRGB {
+		return float64(sqDiffRGB(a, b))
+	}
+	ax, ay, az := space.coords(a)
+	bx, by, bz := space.coords(b)
+	dx, dy, dz := ax-bx, ay-by, az-bz
+	return dx*dx + dy*dy + dz*dz
+}
+
+// nearestIn returns the index of the color of pal nearest to c in space; in
+// sRGB that of pal.Index.
+func nearestIn(space colorSpace, c color.Color, pal color.Palette) int {
+	if space == colorSpaceSRGB {
+		return pal.Index(c)
+	}
+	best, bestDist := 0, math.MaxFloat64
+	for i, pc := range pal {
+		if d := sqDiffIn(space, c, pc); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// sqDiffRGB is the squared euclidean distance between a and b in 8-bit RGB.
+func sqDiffRGB(a, b color.Color) int {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	dr, dg, db := int(ar>>8)-int(br>>8), int(ag>>8)-int(bg>>8), int(ab>>8)-int(bb>>8)
+	return dr*dr + dg*dg + db*db
+}
+
+// roundUp rounds n up to a multiple of m.
+func roundUp(n, m int) int {
+	return (n + m - 1) / m * m
+}
+
+// colorSpace is where the block aggregators combine colors and where palette
+// colors are matched.
+type colorSpace string
+
+const (
+	colorSpaceSRGB   colorSpace = "srgb"
+	colorSpaceLinear colorSpace = "linear"
+	colorSpaceLab    colorSpace = "lab"
+	colorSpaceOKLab  colorSpace = "oklab"
+)
+
+var colorSpaces = []colorSpace{colorSpaceSRGB, colorSpaceLinear, colorSpaceLab, colorSpaceOKLab}
+
+// AllColorSpaceNames returns the names of the color spaces for ConvertColorSpace.
+func AllColorSpaceNames() []string {
+	var res []string
+	for _, s := range colorSpaces {
+		res = append(res, string(s))
+	}
+	return res
+}
+
+// colorSpaceOf returns the color space in opts, defaulting to sRGB.
+func colorSpaceOf(opts ConvertOptions) colorSpace {
+	return colorSpace(or.String(opts.ColorSpace(), string(colorSpaceSRGB)))
+}
+
+func validateColorSpace(s colorSpace) error {
+	for _, cs := range colorSpaces {
+		if s == cs {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid color space: %s; must be one of %s", s, strings.Join(AllColorSpaceNames(), ", "))
+}
+
+// fromSRGB converts straight, i.e. not premultiplied, sRGB components in
+// [0, 255] to s. Components out of that range, as in dithering, are
+// extrapolated.
+func (s colorSpace) fromSRGB(r, g, b float64) (float64, float64, float64) {
+	switch s {
+	case colorSpaceLinear:
+		return srgbToLinear(r / 255), srgbToLinear(g / 255), srgbToLinear(b / 255)
+	case colorSpaceLab:
+		return linearToLab(srgbToLinear(r/255), srgbToLinear(g/255), srgbToLinear(b/255))
+	case colorSpaceOKLab:
+		return linearToOKLab(srgbToLinear(r/255), srgbToLinear(g/255), srgbToLinear(b/255))
+	}
+	return r, g, b
+}
+
+// toSRGB is the inverse of fromSRGB. The result may be out of [0, 255].
+func (s colorSpace) toSRGB(x, y, z float64) (float64, float64, float64) {
+	switch s {
+	case colorSpaceLinear:
+		return 255 * linearToSRGB(x), 255 * linearToSRGB(y), 255 * linearToSRGB(z)
+	case colorSpaceLab:
+		r, g, b := labToLinear(x, y, z)
+		return 255 * linearToSRGB(r), 255 * linearToSRGB(g), 255 * linearToSRGB(b)
+	case colorSpaceOKLab:
+		r, g, b := okLabToLinear(x, y, z)
+		return 255 * linearToSRGB(r), 255 * linearToSRGB(g), 255 * linearToSRGB(b)
+	}
+	return x, y, z
+}
+
+// srgbToLinear undoes the sRGB transfer function of v in [0, 1], mirrored
+// for negative v.
+func srgbToLinear(v float64) float64 {
+	if v < 0 {
+		return -srgbToLinear(-v)
+	}
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	if v < 0 {
+		return -linearToSRGB(-v)
+	}
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// The D65 white point of CIE XYZ.
+const whiteX, whiteY, whiteZ = 0.95047, 1.0, 1.08883
+
+func linearToLab(r, g, b float64) (float64, float64, float64) {
+	x := (0.4124564*r + 0.3575761*g + 0.1804375*b) / whiteX
+	y := (0.2126729*r + 0.7151522*g + 0.0721750*b) / whiteY
+	z := (0.0193339*r + 0.1191920*g + 0.9503041*b) / whiteZ
+	fx, fy, fz := labF(x), labF(y), labF(z)
+	return 116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)
+}
+
+func labToLinear(l, a, b float64) (float64, float64, float64) {
+	fy := (l + 16) / 116
+	x, y, z := whiteX*labFInv(fy+a/500), whiteY*labFInv(fy), whiteZ*labFInv(fy-b/200)
+	return 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z
+}
+
+const labDelta = 6.0 / 29
+
+func labF(t float64) float64 {
+	if t > labDelta*labDelta*labDelta {
+		return math.Cbrt(t)
+	}
+	return t/(3*labDelta*labDelta) + 4.0/29
+}
+
+func labFInv(t float64) float64 {
+	if t > labDelta {
+		return t * t * t
+	}
+	return 3 * labDelta * labDelta * (t - 4.0/29)
+}
+
+// linearToOKLab and okLabToLinear use the matrices of
+// https://bottosson.github.io/posts/oklab/.
+func linearToOKLab(r, g, b float64) (float64, float64, float64) {
+	l := math.Cbrt(0.4122214708*r + 0.5363325363*g + 0.0514459929*b)
+	m := math.Cbrt(0.2119034982*r + 0.6806995451*g + 0.1073969566*b)
+	s := math.Cbrt(0.0883024619*r + 0.2817188376*g + 0.6299787005*b)
+	return 0.2104542553*l + 0.7936177850*m - 0.0040720468*s,
+		1.9779984951*l - 2.4285922050*m + 0.4505937099*s,
+		0.0259040371*l + 0.7827717662*m - 0.8086757660*s
+}
+
+func okLabToLinear(L, a, b float64) (float64, float64, float64) {
+	l := L + 0.3963377774*a + 0.2158037573*b
+	m := L - 0.1055613458*a - 0.0638541728*b
+	s := L - 0.0894841775*a - 1.2914855480*b
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+}
@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"image/color"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestColorSpaces(t *testing.T) {
+	for _, test := range []struct {
+		space   colorSpace
+		r, g, b float64
+		x, y, z float64
+	}{
+		{colorSpaceSRGB, 12, 34, 56, 12, 34, 56},
+		{colorSpaceLinear, 255, 0, 0, 1, 0, 0},
+		{colorSpaceLinear, 188, 188, 188, 0.5029, 0.5029, 0.5029},
+		{colorSpaceLab, 255, 255, 255, 100, 0, 0},
+		{colorSpaceLab, 0, 0, 0, 0, 0, 0},
+		{colorSpaceLab, 255, 0, 0, 53.24, 80.09, 67.20},
+		{colorSpaceOKLab, 255, 255, 255, 1, 0, 0},
+		{colorSpaceOKLab, 255, 0, 0, 0.6280, 0.2249, 0.1258},
+	} {
+		x, y, z := test.space.fromSRGB(test.r, test.g, test.b)
+		const eps = 0.01
+		if math.Abs(x-test.x) > eps || math.Abs(y-test.y) > eps || math.Abs(z-test.z) > eps {
+			t.Errorf("%s.fromSRGB(%v, %v, %v) = %.4f, %.4f, %.4f, want %v, %v, %v", test.space, test.r, test.g, test.b, x, y, z, test.x, test.y, test.z)
+		}
+	}
+
+	for _, space := range colorSpaces {
+		for _, c := range [][3]float64{{0, 0, 0}, {255, 255, 255}, {12, 200, 99}, {255, 0, 128}} {
+			r, g, b := space.toSRGB(space.fromSRGB(c[0], c[1], c[2]))
+			if math.Abs(r-c[0]) > 1e-3 || math.Abs(g-c[1]) > 1e-3 || math.Abs(b-c[2]) > 1e-3 {
+				t.Errorf("%s round trip of %v = %v, %v, %v", space, c, r, g, b)
+			}
+		}
+	}
+}
+
+func TestSpaceAggregators(t *testing.T) {
+	gray := func(v uint8) color.RGBA { return color.RGBA{v, v, v, 255} }
+	img := halvesImage(4, 2, color.Black, color.White)
+	for _, test := range []struct {
+		space     colorSpace
+		mean, med color.RGBA
+	}{
+		{colorSpaceSRGB, gray(127), gray(127)},
+		// Half the light of white is lighter than the sRGB midpoint.
+		{colorSpaceLinear, gray(188), gray(188)},
+		{colorSpaceLab, gray(119), gray(119)},
+		{colorSpaceOKLab, gray(99), gray(99)},
+	} {
+		opts := MakeConvertOptions(ConvertColorSpace(string(test.space)))
+		for _, aggr := range []struct {
+			name string
+			fn   colorAggrFn
+			want color.RGBA
+		}{{"mean", meanAggr(opts), test.mean}, {"median", medianAggr(opts), test.med}} {
+			if got := aggr.fn(img, 0, 2, 0, 4); got != aggr.want {
+				t.Errorf("%s %s = %v, want %v", test.space, aggr.name, got, aggr.want)
+			}
+		}
+	}
+
+	// Transparent pixels only count towards alpha.
+	clear := halvesImage(2, 1, color.Transparent, color.RGBA{200, 100, 0, 255})
+	if got, want := meanAggr(MakeConvertOptions(ConvertColorSpace("lab")))(clear, 0, 1, 0, 2), (color.RGBA{100, 50, 0, 128}); got != want {
+		t.Errorf("lab mean with transparent pixels = %v, want %v", got, want)
+	}
+}
+
+func TestInvalidColorSpace(t *testing.T) {
+	if _, err := ConvertImage(randomImage(4, 4, 1), "block_mean", ConvertColorSpace("hsv")); err == nil {
+		t.Errorf("ConvertImage with an invalid color space succeeded")
+	}
+}
+
+func TestNearestIn(t *testing.T) {
+	// Gray 120 is closer to black in sRGB, but its lightness in Lab is just
+	// over halfway to white.
+	pal := color.Palette{color.Black, color.White}
+	gray := color.RGBA{120, 120, 120, 255}
+	for _, test := range []struct {
+		space colorSpace
+		want  int
+	}{
+		{colorSpaceSRGB, 0},
+		{colorSpaceLab, 1},
+	} {
+		if got := nearestIn(test.space, gray, pal); got != test.want {
+			t.Errorf("nearestIn(%s) = %d, want %d", test.space, got, test.want)
+		}
+	}
+
+	// The converters snap to the hardware colors in the color space too: a
+	// very dark blue is nearest the darkest gray in sRGB but black in Lab.
+	img := uniformImage(4, 8, color.RGBA{0, 0, 17, 255})
+	for _, test := range []struct {
+		space, want string
+	}{
+		{"srgb", "\x1b[48;5;232m"},
+		{"lab", "\x1b[48;5;16m"},
+	} {
+		res, err := ConvertImage(img, "ansi256", ConvertBlockSize(4), ConvertColorSpace(test.space))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(res.Text(), test.want) {
+			t.Errorf("ansi256 in %s = %q, want it to start with %q", test.space, res.Text(), test.want)
+		}
+	}
+}
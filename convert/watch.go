@@ -0,0 +1,173 @@
+package convert
+
+import (
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultWatchInterval = 500 * time.Millisecond
+	defaultWatchDebounce = 300 * time.Millisecond
+)
+
+// fileState is what polling compares to tell a file changed.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// watcher re-renders input when the files it names, or the palette file,
+// change.
+type watcher struct {
+	input string
+	cOpts []ConvertOption
+	opts  ConvertOptions
+	// Outputs written so far, which aren't watched and may be overwritten.
+	own map[string]bool
+}
+
+// Watch converts input, which may be a directory or glob like the input of
+// ExpandInputs, and converts it again each time its files or the palette file
+// change, until ctx is done. A render starts once nothing has changed for the
+// debounce. Outputs the watch wrote itself are overwritten as if --force was
+// given, while existing files are only overwritten with Force. Files named
+// like the outputs of a converter, e.g. "foo-block_mean-0010.png", are never
+// taken for inputs.
+func Watch(ctx context.Context, input string, cOpts []ConvertOption, wOpts ...WatchOption) error {
+	if input == stdinInputs {
+		return errors.Errorf("cannot watch inputs read from stdin")
+	}
+	opts := MakeWatchOptions(wOpts...)
+	interval, debounce := opts.Interval(), opts.Debounce()
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	if debounce <= 0 {
+		debounce = defaultWatchDebounce
+	}
+
+	w := &watcher{input: input, cOpts: cOpts, opts: MakeConvertOptions(cOpts...), own: map[string]bool{}}
+	w.render()
+	last := w.snapshot()
+	log.Printf("watching %s for changes", input)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var changedAt time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		if cur := w.snapshot(); !sameSnapshot(cur, last) {
+			last, changedAt = cur, time.Now()
+			continue
+		}
+		if !changedAt.IsZero() && time.Since(changedAt) >= debounce {
+			changedAt = time.Time{}
+			w.render()
+			last = w.snapshot()
+		}
+	}
+}
+
+// inputs returns the files named by input, leaving out outputs, ours or an
+// earlier watch's, which may be next to them.
+func (w *watcher) inputs() []string {
+	var res []string
+	if inputs, err := ExpandInputs(w.input, nil); err == nil {
+		for _, f := range inputs {
+			if !w.own[f] && (f == w.input || !isConverterOutput(f)) {
+				res = append(res, f)
+			}
+		}
+	}
+	return res
+}
+
+// files returns the files whose changes trigger a render.
+func (w *watcher) files() []string {
+	res := w.inputs()
+	if f := w.opts.PaletteFile(); f != "" {
+		res = append(res, f)
+	}
+	return res
+}
+
+func (w *watcher) snapshot() map[string]fileState {
+	res := map[string]fileState{}
+	for _, f := range w.files() {
+		if fi, err := os.Stat(f); err == nil {
+			res[f] = fileState{fi.ModTime(), fi.Size()}
+		}
+	}
+	return res
+}
+
+// isConverterOutput returns whether file is named like the output of one of
+// the registered converters, i.e. ends in the suffix the converter adds, such
+// as "-block_mean-0010" with any block size, followed by any tags.
+func isConverterOutput(file string) bool {
+	base := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	for _, name := range globalReg.AllConverterNames() {
+		sample := globalReg.Get(name).OutputFileName("x.png", MakeConvertOptions())
+		suffix := strings.TrimPrefix(strings.TrimSuffix(sample, path.Ext(sample)), "x")
+		pattern := digits.ReplaceAllString(regexp.QuoteMeta(suffix), `\d+`)
+		if regexp.MustCompile(`.` + pattern + `(-[\w.]+)*$`).MatchString(base) {
+			return true
+		}
+	}
+	return false
+}
+
+var digits = regexp.MustCompile(`\d+`)
+
+func sameSnapshot(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for f, s := range a {
+		if t, ok := b[f]; !ok || !t.modTime.Equal(s.modTime) || t.size != s.size {
+			return false
+		}
+	}
+	return true
+}
+
+// render converts the inputs once, logging instead of returning failures so
+// a file saved halfway doesn't end the watch.
+func (w *watcher) render() {
+	start := time.Now()
+	var own []string
+	for o := range w.own {
+		own = append(own, o)
+	}
+	cOpts := append(append([]ConvertOption{}, w.cOpts...), ConvertOverwrite(own))
+	inputs := w.inputs()
+	if len(inputs) == 0 {
+		log.Printf("nothing to render in %s", w.input)
+		return
+	}
+	var outputs []string
+	var err error
+	if len(inputs) == 1 && inputs[0] == w.input {
+		outputs, err = Convert(w.input, cOpts...)
+	} else {
+		outputs, err = ConvertBatch(inputs, cOpts...)
+	}
+	for _, o := range outputs {
+		w.own[o] = true
+	}
+	if err != nil {
+		log.Printf("rendering %s failed after %v: %v", w.input, time.Since(start), err)
+		return
+	}
+	log.Printf("rendered %s to %d outputs in %v", w.input, len(outputs), time.Since(start))
+}
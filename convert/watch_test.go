@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"context"
+	"image/png"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spudtrooper/goutil/io"
+)
+
+func TestWatchRerendersOnChange(t *testing.T) {
+	dir := t.TempDir()
+	input := path.Join(dir, "a.png")
+	output := path.Join(dir, "out.png")
+	writeTestPNG(t, input, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, input,
+			[]ConvertOption{ConvertConverters([]string{"block_mean"}), ConvertBlockSize(4), ConvertOutputFile(output)},
+			WatchInterval(10*time.Millisecond), WatchDebounce(20*time.Millisecond))
+	}()
+
+	readOutput := func() []byte {
+		b, _ := os.ReadFile(output)
+		return b
+	}
+	waitFor := func(cond func() bool) {
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", output)
+			}
+		}
+	}
+	waitFor(func() bool { return len(readOutput()) > 0 })
+	first := readOutput()
+
+	// Changes the size too, so the change is seen even on coarse mtimes.
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, randomImage(12, 12, 2)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	waitFor(func() bool { b := readOutput(); return len(b) > 0 && string(b) != string(first) })
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Watch: %v", err)
+	}
+}
+
+func TestWatchKeepsExistingOutputs(t *testing.T) {
+	for _, force := range []bool{false, true} {
+		dir := t.TempDir()
+		input := path.Join(dir, "a.png")
+		output := path.Join(dir, "out.png")
+		writeTestPNG(t, input, 1)
+		if err := os.WriteFile(output, []byte("stale"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		w := &watcher{
+			input: input,
+			cOpts: []ConvertOption{ConvertConverters([]string{"block_mean"}), ConvertBlockSize(4), ConvertOutputFile(output), ConvertForce(force)},
+			own:   map[string]bool{},
+		}
+		w.render()
+		if b, _ := os.ReadFile(output); (string(b) != "stale") != force {
+			t.Errorf("force=%v: %s overwritten = %v", force, output, string(b) != "stale")
+		}
+	}
+}
+
+func TestWatchOverwritesOwnOutputs(t *testing.T) {
+	dir := t.TempDir()
+	input := path.Join(dir, "a.png")
+	writeTestPNG(t, input, 1)
+	w := &watcher{
+		input: input,
+		cOpts: []ConvertOption{ConvertConverters([]string{"zx_spectrum"}), ConvertZxScr(true)},
+		own:   map[string]bool{},
+	}
+	w.render()
+	if len(w.own) != 1 {
+		t.Fatalf("own = %v after the first render, want one output", w.own)
+	}
+	var output string
+	for o := range w.own {
+		output = o
+	}
+	before, _ := os.Stat(output)
+	// The sidecar is overwritten along with its output.
+	time.Sleep(10 * time.Millisecond)
+	w.render()
+	if after, err := os.Stat(output); err != nil || !after.ModTime().After(before.ModTime()) {
+		t.Errorf("%s not overwritten by the second render: %v", output, err)
+	}
+	if scr := companionFile(output, ".scr"); !io.FileExists(scr) {
+		t.Errorf("%s missing", scr)
+	}
+}
+
+func TestWatchInputsSkipOutputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"a.png", "hero-nes.png", "trip.png", "a-block_mean-0004.png", "a-nes-0010-nes.png", "a-websafe_pixelated.png", "a-gameboy-160x144-tileset.png"} {
+		writeTestPNG(t, path.Join(dir, f), 1)
+	}
+	w := &watcher{input: dir, own: map[string]bool{}}
+	got := w.inputs()
+	want := []string{path.Join(dir, "a.png"), path.Join(dir, "hero-nes.png"), path.Join(dir, "trip.png")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inputs() = %v, want %v", got, want)
+	}
+
+	// A file named explicitly is an input whatever its name.
+	input := path.Join(dir, "a-block_mean-0004.png")
+	w = &watcher{input: input, own: map[string]bool{}}
+	if got := w.inputs(); !reflect.DeepEqual(got, []string{input}) {
+		t.Errorf("inputs() = %v, want %v", got, []string{input})
+	}
+}
+
+func TestWatchStdin(t *testing.T) {
+	if err := Watch(context.Background(), "-", nil); err == nil {
+		t.Errorf("Watch of stdin succeeded")
+	}
+}
@@ -0,0 +1,54 @@
+package convert
+
+import "time"
+
+//go:generate genopts --prefix=Watch --outfile=watchoptions.go "interval:time.Duration" "debounce:time.Duration"
+
+type WatchOption func(*watchOptionImpl)
+
+type WatchOptions interface {
+	Interval() time.Duration
+	Debounce() time.Duration
+}
+
+func WatchInterval(interval time.Duration) WatchOption {
+	return func(opts *watchOptionImpl) {
+		opts.interval = interval
+	}
+}
+func WatchIntervalFlag(interval *time.Duration) WatchOption {
+	return func(opts *watchOptionImpl) {
+		opts.interval = *interval
+	}
+}
+
+func WatchDebounce(debounce time.Duration) WatchOption {
+	return func(opts *watchOptionImpl) {
+		opts.debounce = debounce
+	}
+}
+func WatchDebounceFlag(debounce *time.Duration) WatchOption {
+	return func(opts *watchOptionImpl) {
+		opts.debounce = *debounce
+	}
+}
+
+type watchOptionImpl struct {
+	interval time.Duration
+	debounce time.Duration
+}
+
+func (w *watchOptionImpl) Interval() time.Duration { return w.interval }
+func (w *watchOptionImpl) Debounce() time.Duration { return w.debounce }
+
+func makeWatchOptionImpl(opts ...WatchOption) *watchOptionImpl {
+	res := &watchOptionImpl{}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func MakeWatchOptions(opts ...WatchOption) WatchOptions {
+	return makeWatchOptionImpl(opts...)
+}
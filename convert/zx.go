@@ -0,0 +1,112 @@
+package convert
+
+import (
+	"fmt"
+	"image"
+	"path"
+	"strings"
+
+	"github.com/spudtrooper/eightbit/palette"
+)
+
+const (
+	zxWidth    = 256
+	zxHeight   = 192
+	zxCellSize = 8
+	// 6144 bytes of bitmap followed by 768 of attributes.
+	zxScrBitmapSize = zxWidth * zxHeight / 8
+	zxScrSize       = zxScrBitmapSize + (zxWidth/zxCellSize)*(zxHeight/zxCellSize)
+)
+
+// zxScreen is a ZX Spectrum screen: every 8x8 cell has an ink and a paper
+// color that are either both normal or both BRIGHT. Each cell's colors are
+// paper then ink, as indices into the "zx_spectrum" palette.
+type zxScreen struct {
+	*cellScreen
+}
+
+// zxColor returns the Spectrum color number, 0-7, and BRIGHT bit of index i
+// into the "zx_spectrum" palette.
+func zxColor(i uint8) (uint8, bool) {
+	if i < 8 {
+		return i, false
+	}
+	return i - 7, true
+}
+
+func makeZXScreen(inputImage image.Image, space colorSpace) *zxScreen {
+	zx, _ := palette.Get("zx_spectrum")
+	img := coverAndCrop(inputImage, zxWidth, zxHeight)
+
+	// Black is the same with and without BRIGHT, so it's in both sets.
+	normal, bright := []uint8{0}, []uint8{0}
+	for i := uint8(1); i < 8; i++ {
+		normal = append(normal, i)
+		bright = append(bright, i+7)
+	}
+	choices := append(combinations(normal, 2), combinations(bright, 2)...)
+
+	return &zxScreen{makeCellScreen(img, zx.Colors, zxCellSize, zxCellSize, choices, space)}
+}
+
+// scr returns the 6912-byte screen memory dump.
+func (s *zxScreen) scr() []byte {
+	res := make([]byte, zxScrSize)
+	for y := 0; y < s.height; y++ {
+		// The bitmap is stored in thirds of the screen, each of which
+		// interleaves the pixel rows of its character rows.
+		row := (y&0xC0)<<5 | (y&0x07)<<8 | (y&0x38)<<2
+		for x := 0; x < s.width; x++ {
+			if s.pixels[y*s.width+x] == 1 {
+				res[row|x>>3] |= 0x80 >> (x & 7)
+			}
+		}
+	}
+	for cy := 0; cy < s.cellsHigh(); cy++ {
+		for cx := 0; cx < s.cellsWide(); cx++ {
+			colors := s.cellColors[cy*s.cellsWide()+cx]
+			paper, paperBright := zxColor(colors[0])
+			ink, inkBright := zxColor(colors[1])
+			attr := paper<<3 | ink
+			if paperBright || inkBright {
+				attr |= 0x40
+			}
+			res[zxScrBitmapSize+cy*s.cellsWide()+cx] = attr
+		}
+	}
+	return res
+}
+
+func (s *zxScreen) nativeFormats() map[string]nativeEncoder {
+	return map[string]nativeEncoder{
+		".scr": func() (map[string][]byte, error) {
+			return map[string][]byte{".scr": s.scr()}, nil
+		},
+	}
+}
+
+func zxSpectrum(input string, inputImage image.Image, opts ConvertOptions) (ConvertResult, error) {
+	s := makeZXScreen(inputImage, colorSpaceOf(opts))
+	var sidecars map[string][]byte
+	if opts.ZxScr() {
+		sidecars = map[string][]byte{".scr": s.scr()}
+	}
+	res := makeNativeConvertResult(s.image(), s, sidecars)
+	return res, nil
+}
+
+type zxConverter struct{ baseConverter }
+
+func (c *zxConverter) OutputFileName(input string, opts ConvertOptions) string {
+	ext := path.Ext(input)
+	base := strings.Replace(path.Base(input), ext, "", 1)
+	return fmt.Sprintf("%s-%s%s", base, c.Name(), ext)
+}
+
+func init() {
+	globalReg.Register(&zxConverter{
+		baseConverter{
+			name: "zx_spectrum",
+			conv: zxSpectrum,
+		}})
+}
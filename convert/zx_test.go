@@ -0,0 +1,46 @@
+package convert
+
+import "testing"
+
+func TestZXScrMatchesImage(t *testing.T) {
+	s := makeZXScreen(randomImage(300, 200, 3), colorSpaceSRGB)
+	scr := s.scr()
+	if len(scr) != 6912 {
+		t.Fatalf("len(scr) = %d, want 6912", len(scr))
+	}
+	for y := 0; y < zxHeight; y++ {
+		third, charRow, pixelRow := y/64, (y/8)%8, y%8
+		for x := 0; x < zxWidth; x++ {
+			b := scr[third*2048+pixelRow*256+charRow*32+x/8]
+			isInk := b&(0x80>>(x%8)) != 0
+			attr := scr[6144+(y/8)*32+x/8]
+			c := attr >> 3 & 7
+			if isInk {
+				c = attr & 7
+			}
+			want, wantBright := zxColor(s.colorIndexAt(x, y))
+			if bright := attr&0x40 != 0; c != want || (c != 0 && bright != wantBright) {
+				t.Fatalf("pixel (%d,%d) = %d bright=%t, want %d bright=%t", x, y, c, bright, want, wantBright)
+			}
+		}
+	}
+}
+
+func TestZXScrConflicts(t *testing.T) {
+	img := randomImage(300, 200, 3)
+	res, err := ConvertImage(img, "zx_spectrum", ConvertZxScr(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Sidecars()[".scr"]) != zxScrSize {
+		t.Errorf("len(.scr) = %d, want %d", len(res.Sidecars()[".scr"]), zxScrSize)
+	}
+	for name, opts := range map[string][]ConvertOption{
+		"palette": {ConvertPalette("gameboy_dmg")},
+		"resize":  {ConvertResizeWidth(100), ConvertResizeHeight(100)},
+	} {
+		if _, err := ConvertImage(img, "zx_spectrum", append(opts, ConvertZxScr(true))...); err == nil {
+			t.Errorf("%s: ConvertImage with .scr succeeded", name)
+		}
+	}
+}
@@ -6,7 +6,6 @@ replace github.com/spudtrooper/goutil => ../goutil
 
 require (
 	github.com/jyotiska/go-webcolors v0.0.0-20150821045656-d3232ed69418
-	github.com/markdaws/go-effects v0.0.0-20200131234403-fdc64c8dc0f7
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/noelyahan/impexp v0.0.0-20201209034304-ee159d84b42f
 	github.com/noelyahan/mergi v0.0.0-20190514155713-69271a4267fb
@@ -17,7 +16,6 @@ require (
 
 require (
 	github.com/fatih/color v1.13.0 // indirect
-	github.com/markdaws/go-timing v0.0.0-20170130172127-b53baafd482a // indirect
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
 	github.com/noelyahan/mergitrans v0.0.0-20190507035323-73e76dcd7d2a // indirect
@@ -1,30 +1,64 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"os"
 	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spudtrooper/eightbit/convert"
 	"github.com/spudtrooper/eightbit/gitversion"
+	"github.com/spudtrooper/eightbit/palette"
 	"github.com/spudtrooper/goutil/check"
 	"github.com/spudtrooper/goutil/slice"
+	"github.com/spudtrooper/goutil/term"
 )
 
+// defaultPreviewWidth is the width of --preview when that of the terminal is unknown.
+const defaultPreviewWidth = 80
+
 var (
-	input                 = flag.String("input", "", "input image")
-	output                = flag.String("output", "", "output image")
+	input                 = flag.String("input", "", "input image, a directory of images, a glob like 'data/in/*.png', or - to read the names of images from stdin, one per line")
+	jobs                  = flag.Int("jobs", 0, "number of inputs to convert at once when there are several; defaults to the number of CPUs")
+	output                = flag.String("output", "", "output image, or - to print the output of a text converter such as ascii to stdout")
 	outputDir             = flag.String("output_dir", "", "output dir")
 	pixelateBlockSize     = flag.Int("pixelate_block_size", 16, "blocksize for downsampling")
+	pixelateResolution    = flag.Int("pixelate_resolution", 1280, "length in pixels of the longest side of the working image for pixelated converters; the aspect ratio is kept and the result is scaled back to the input size")
 	blockSize             = flag.Int("block_size", 10, "blocksize overlap and block converters")
+	threads               = flag.Int("threads", 0, "number of goroutines the overlap, nes and text converters split the rows of blocks across; defaults to the number of CPUs")
 	resizeHeight          = flag.Int("resize_height", 0, "height in pixels of the final image; must be used with --resize_width")
 	resizeWidth           = flag.Int("resize_width", 0, "width in pixels of the final image; must be used with --resize_height")
 	force                 = flag.Bool("force", false, "overwrite existing files")
-	converters            = flag.String("converters", "pixelated", "the kinds of converter to use or 'all' for all of them. If you don't specify an output file, the output file will be next to the source file with this tag at the end of the base name.")
+	converters            = flag.String("converters", "pixelated", "the kinds of converter to use or 'all' for all of them. Chain converters with '|', e.g. 'block_median|websafe_pixelated', to feed the output of one into the next. If you don't specify an output file, the output file will be next to the source file with this tag at the end of the base name.")
+	gameboyGreen          = flag.Bool("gameboy_green", false, "use the green shades of the original Game Boy instead of grays for the gameboy converter")
+	zxScr                 = flag.Bool("zx_scr", false, "also write the 6912-byte ZX Spectrum screen dump next to the output of the zx_spectrum converter")
+	textMedian            = flag.Bool("text_median", false, "use the median instead of the mean color of each block for the ascii, ansi256 and ansitruecolor converters")
+	resultJSON            = flag.String("result_json", "", "if set, write a JSON array describing each output to this file: its size, timing, palette, color histogram and, for block converters, the grid of block colors")
+	tileset               = flag.Bool("tileset", false, "also slice the output into tiles, dedupe identical and flipped ones and write <output>-tileset.png with a tilemap in <output>-tilemap.csv, .json and .tmx (Tiled)")
+	tileSize              = flag.Int("tile_size", 0, "size in pixels of the square tiles for --tileset; defaults to --block_size")
+	watch                 = flag.Bool("watch", false, "keep running and convert --input again each time it, or --palette_file, changes; its own outputs are overwritten without --force, but existing files are not")
+	watchInterval         = flag.Duration("watch_interval", 500*time.Millisecond, "how often --watch polls for changes")
+	watchDebounce         = flag.Duration("watch_debounce", 300*time.Millisecond, "how long the files must be unchanged before --watch converts them again")
+	addr                  = flag.String("addr", ":8080", "address to listen on for the serve command")
+	maxUploadBytes        = flag.Int64("max_upload_bytes", 32<<20, "largest image the serve command accepts")
+	maxPixels             = flag.Int64("max_pixels", 64<<20, "largest image in pixels, width times height, the serve command decodes")
+	maxConcurrent         = flag.Int("max_concurrent", 0, "most conversions the serve command runs at once; defaults to the number of CPUs")
 	printConverters       = flag.Bool("print_converters", false, "print the names of all the converters and exit")
+	pal                   = flag.String("palette", "", "name of a palette to map the output of every converter onto; see --print_palettes")
+	paletteFile           = flag.String("palette_file", "", "palette file to map the output of every converter onto; one of GIMP .gpl, Adobe .act, JASC .pal or Lospec .hex")
+	paletteSize           = flag.Int("palette_size", 0, "if > 0, derive a palette of this many colors from the input image and map the output of every converter onto it")
+	paletteMethod         = flag.String("palette_method", "median_cut", "how to derive the palette for --palette_size: one of "+strings.Join(palette.AllMethodNames(), ", "))
+	dither                = flag.String("dither", "", "dithering to use when reducing to a palette: one of "+strings.Join(palette.AllDitherNames(), ", "))
+	colorSpace            = flag.String("color_space", "srgb", "color space to aggregate blocks and match palette colors in: one of "+strings.Join(convert.AllColorSpaceNames(), ", ")+"; the perceptual lab and oklab keep dark regions from getting muddy")
+	printPalettes         = flag.Bool("print_palettes", false, "print the names of all the palettes and exit")
 	colorHist             = flag.Bool("color_hist", false, "print a histogram of web colors from the input image")
-	openAll               = flag.Bool("open_all", false, "try to open the output files at the end")
+	openAll               = flag.Bool("open_all", false, "try to open the output files at the end with the macOS open command; see --preview")
+	preview               = flag.Bool("preview", false, "print each output to the terminal at the end, at the width of the terminal")
 	animateThreads        = flag.Int("animate_threads", 0, "number of threads for producing animations")
 	animateBlockSizeStart = flag.Int("animate_block_size_start", 1, "start block size for animations")
 	animateBlockSizeEnd   = flag.Int("animate_block_size_end", 150, "end block size for animations")
@@ -38,6 +72,17 @@ func realMain() error {
 		return nil
 	}
 
+	// "eightbit serve --addr :8080" serves the converters over HTTP.
+	if flag.Arg(0) == "serve" {
+		if err := flag.CommandLine.Parse(flag.Args()[1:]); err != nil {
+			return err
+		}
+		return convert.Serve(*addr,
+			convert.ServeMaxUploadBytes(*maxUploadBytes),
+			convert.ServeMaxConcurrent(*maxConcurrent),
+			convert.ServeMaxPixels(*maxPixels))
+	}
+
 	if *printConverters {
 		fmt.Println("Printing the names of all the converters...")
 		for i, c := range convert.AllConverterNames() {
@@ -46,17 +91,30 @@ func realMain() error {
 		return nil
 	}
 
+	if *printPalettes {
+		fmt.Println("Printing the names of all the palettes...")
+		for i, name := range palette.AllPaletteNames() {
+			p, _ := palette.Get(name)
+			fmt.Printf("  [%d] %s (%d colors): %s\n", i+1, name, len(p.Colors), p.Description)
+		}
+		return nil
+	}
+
 	if *input == "" {
 		return errors.Errorf("--input required")
 	}
+	if *pixelateResolution < 0 {
+		return errors.Errorf("--pixelate_resolution must not be negative, got %d", *pixelateResolution)
+	}
 
-	outputs, err := convert.Convert(*input,
+	cOpts := []convert.ConvertOption{
 		convert.ConvertOutputFile(*output),
 		convert.ConvertOutputDir(*outputDir),
 		convert.ConvertBlockSize(*blockSize),
 		convert.ConvertPixelateBlockSize(*pixelateBlockSize),
-		convert.ConvertResizeWidth(uint(*resizeHeight)),
-		convert.ConvertResizeHeight(uint(*resizeWidth)),
+		convert.ConvertPixelateResolution(uint(*pixelateResolution)),
+		convert.ConvertResizeWidth(uint(*resizeWidth)),
+		convert.ConvertResizeHeight(uint(*resizeHeight)),
 		convert.ConvertForce(*force),
 		convert.ConvertConverters(slice.Strings(*converters, ",")),
 		convert.ConvertExcept(slice.Strings(*except, ",")),
@@ -64,10 +122,59 @@ func realMain() error {
 		convert.ConvertAnimateThreads(*animateThreads),
 		convert.ConvertAnimateBlockSizeRange(convert.MakeBlockSizeRange(*animateBlockSizeStart, *animateBlockSizeEnd, *animateBlockSizeStep)),
 		convert.ConvertAnimateReverse(*animateReverse),
-	)
+		convert.ConvertPalette(*pal),
+		convert.ConvertPaletteFile(*paletteFile),
+		convert.ConvertPaletteSize(*paletteSize),
+		convert.ConvertPaletteMethod(*paletteMethod),
+		convert.ConvertDither(*dither),
+		convert.ConvertGameboyGreen(*gameboyGreen),
+		convert.ConvertZxScr(*zxScr),
+		convert.ConvertTextMedian(*textMedian),
+		convert.ConvertResultJSON(*resultJSON),
+		convert.ConvertTileset(*tileset),
+		convert.ConvertTileSize(*tileSize),
+		convert.ConvertJobs(*jobs),
+		convert.ConvertThreads(*threads),
+		convert.ConvertColorSpace(*colorSpace),
+	}
+
+	if *watch {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		return convert.Watch(ctx, *input, cOpts,
+			convert.WatchInterval(*watchInterval),
+			convert.WatchDebounce(*watchDebounce))
+	}
+
+	inputs, err := convert.ExpandInputs(*input, os.Stdin)
 	if err != nil {
 		return err
 	}
+	var outputs []string
+	if len(inputs) == 1 && inputs[0] == *input {
+		outputs, err = convert.Convert(*input, cOpts...)
+	} else {
+		outputs, err = convert.ConvertBatch(inputs, cOpts...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *preview {
+		width := defaultPreviewWidth
+		if size, err := term.DetectTerminalSize(); err == nil {
+			width = size.Width
+		}
+		for _, output := range outputs {
+			if output == "-" {
+				continue
+			}
+			fmt.Println(output)
+			if err := convert.Preview(os.Stdout, output, width); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
 
 	if *openAll {
 		if err := exec.Command("open", outputs...).Run(); err != nil {
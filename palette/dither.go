@@ -0,0 +1,247 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Dither names a way to spread the error of mapping an image onto a palette.
+// All of them are deterministic, so the same input always gives the same output.
+type Dither string
+
+const (
+	DitherNone              Dither = ""
+	DitherFloydSteinberg    Dither = "floyd_steinberg"
+	DitherAtkinson          Dither = "atkinson"
+	DitherJarvisJudiceNinke Dither = "jarvis_judice_ninke"
+	DitherStucki            Dither = "stucki"
+	DitherSierra            Dither = "sierra"
+	DitherBayer2            Dither = "bayer2"
+	DitherBayer4            Dither = "bayer4"
+	DitherBayer8            Dither = "bayer8"
+)
+
+type diffusion struct {
+	dx, dy int
+	weight float64
+}
+
+type diffusionKernel struct {
+	diffusions []diffusion
+	divisor    float64
+}
+
+var diffusionKernels = map[Dither]diffusionKernel{
+	DitherFloydSteinberg: {[]diffusion{
+		{1, 0, 7},
+		{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	}, 16},
+	// Atkinson only diffuses 6/8 of the error, which keeps more contrast.
+	DitherAtkinson: {[]diffusion{
+		{1, 0, 1}, {2, 0, 1},
+		{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{0, 2, 1},
+	}, 8},
+	DitherJarvisJudiceNinke: {[]diffusion{
+		{1, 0, 7}, {2, 0, 5},
+		{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+		{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+	}, 48},
+	DitherStucki: {[]diffusion{
+		{1, 0, 8}, {2, 0, 4},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+		{-2, 2, 1}, {-1, 2, 2}, {0, 2, 4}, {1, 2, 2}, {2, 2, 1},
+	}, 42},
+	DitherSierra: {[]diffusion{
+		{1, 0, 5}, {2, 0, 3},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+		{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+	}, 32},
+}
+
+var bayerSizes = map[Dither]int{
+	DitherBayer2: 2,
+	DitherBayer4: 4,
+	DitherBayer8: 8,
+}
+
+// AllDitherNames returns the sorted names of all the dithering modes.
+func AllDitherNames() []string {
+	var names []string
+	for d := range diffusionKernels {
+		names = append(names, string(d))
+	}
+	for d := range bayerSizes {
+		names = append(names, string(d))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateDither returns an error if d isn't a known dithering mode.
+func ValidateDither(d Dither) error {
+	if d == DitherNone {
+		return nil
+	}
+	if _, ok := diffusionKernels[d]; ok {
+		return nil
+	}
+	if _, ok := bayerSizes[d]; ok {
+		return nil
+	}
+	return errors.Errorf("invalid dither: %s", d)
+}
+
+// ApplyDithered maps img onto p like Apply, dithering with d.
+func ApplyDithered(img image.Image, p color.Palette, d Dither) (*image.Paletted, error) {
+	return ApplyDitheredIn(img, p, d, nil)
+}
+
+// ApplyDitheredIn is ApplyDithered matching colors in space. Errors and
+// thresholds are still spread in sRGB.
+func ApplyDitheredIn(img image.Image, p color.Palette, d Dither, space Space) (*image.Paletted, error) {
+	if err := ValidateDither(d); err != nil {
+		return nil, err
+	}
+	if k, ok := diffusionKernels[d]; ok {
+		return errorDiffusion(img, p, k, space), nil
+	}
+	if n, ok := bayerSizes[d]; ok {
+		return ordered(img, p, bayerMatrix(n), space), nil
+	}
+	return ApplyIn(img, p, space), nil
+}
+
+type rgb struct{ r, g, b float64 }
+
+func toRGB(c color.Color) rgb {
+	r, g, b, _ := c.RGBA()
+	return rgb{float64(r >> 8), float64(g >> 8), float64(b >> 8)}
+}
+
+// matcher finds the nearest palette color to an RGB value whose components
+// may be out of the 0-255 range after adding error or threshold offsets.
+type matcher struct {
+	colors []rgb
+	space  Space
+	// The colors in space.
+	coords []rgb
+}
+
+func makeMatcher(p color.Palette, space Space) *matcher {
+	m := &matcher{space: space}
+	for _, c := range p {
+		m.colors = append(m.colors, toRGB(c))
+	}
+	for _, c := range m.colors {
+		m.coords = append(m.coords, m.toSpace(c))
+	}
+	return m
+}
+
+func (m *matcher) toSpace(c rgb) rgb {
+	if m.space == nil {
+		return c
+	}
+	x, y, z := m.space(c.r, c.g, c.b)
+	return rgb{x, y, z}
+}
+
+func (m *matcher) index(c rgb) int {
+	c = m.toSpace(c)
+	best, bestDist := 0, math.MaxFloat64
+	for i, pc := range m.coords {
+		dr, dg, db := c.r-pc.r, c.g-pc.g, c.b-pc.b
+		if dist := dr*dr + dg*dg + db*db; dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+func errorDiffusion(img image.Image, p color.Palette, k diffusionKernel, space Space) *image.Paletted {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	buf := make([]rgb, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			buf[y*w+x] = toRGB(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+
+	m := makeMatcher(p, space)
+	res := image.NewPaletted(bounds, p)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := buf[y*w+x]
+			i := m.index(c)
+			res.SetColorIndex(bounds.Min.X+x, bounds.Min.Y+y, uint8(i))
+			pc := m.colors[i]
+			er, eg, eb := c.r-pc.r, c.g-pc.g, c.b-pc.b
+			for _, d := range k.diffusions {
+				nx, ny := x+d.dx, y+d.dy
+				if nx < 0 || nx >= w || ny >= h {
+					continue
+				}
+				f := d.weight / k.divisor
+				n := &buf[ny*w+nx]
+				n.r += er * f
+				n.g += eg * f
+				n.b += eb * f
+			}
+		}
+	}
+	return res
+}
+
+// bayerMatrix returns the n x n (n a power of 2) ordered dithering matrix
+// with thresholds normalized to [-0.5, 0.5).
+func bayerMatrix(n int) [][]float64 {
+	m := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, 2*size)
+		for y := range next {
+			next[y] = make([]int, 2*size)
+		}
+		for y := 0; y < size; y++ {
+			for x := 0; x < size; x++ {
+				v := 4 * m[y][x]
+				next[y][x] = v
+				next[y][x+size] = v + 2
+				next[y+size][x] = v + 3
+				next[y+size][x+size] = v + 1
+			}
+		}
+		m = next
+	}
+	res := make([][]float64, n)
+	for y := range m {
+		res[y] = make([]float64, n)
+		for x := range m[y] {
+			res[y][x] = (float64(m[y][x])+0.5)/float64(n*n) - 0.5
+		}
+	}
+	return res
+}
+
+func ordered(img image.Image, p color.Palette, thresholds [][]float64, space Space) *image.Paletted {
+	// Spread the thresholds over roughly the distance between neighboring
+	// palette colors, assuming they are evenly spaced in the RGB cube.
+	spread := 255 / math.Max(1, math.Cbrt(float64(len(p)))-1)
+	n := len(thresholds)
+	m := makeMatcher(p, space)
+	bounds := img.Bounds()
+	res := image.NewPaletted(bounds, p)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := toRGB(img.At(x, y))
+			t := thresholds[(y-bounds.Min.Y)%n][(x-bounds.Min.X)%n] * spread
+			res.SetColorIndex(x, y, uint8(m.index(rgb{c.r + t, c.g + t, c.b + t})))
+		}
+	}
+	return res
+}
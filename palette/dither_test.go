@@ -0,0 +1,84 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func gray(w, h int, v uint8) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = v
+	}
+	return img
+}
+
+func countIndex(img *image.Paletted, i uint8) int {
+	var n int
+	for _, p := range img.Pix {
+		if p == i {
+			n++
+		}
+	}
+	return n
+}
+
+var blackAndWhite = color.Palette{color.Black, color.White}
+
+func TestBayer2Checkerboard(t *testing.T) {
+	res, err := ApplyDithered(gray(4, 4, 128), blackAndWhite, DitherBayer2)
+	if err != nil {
+		t.Fatalf("ApplyDithered: %v", err)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if got, want := res.ColorIndexAt(x, y), uint8((x+y)%2); got != want {
+				t.Errorf("index at (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestDitherMidGrayIsHalfWhite(t *testing.T) {
+	for _, name := range AllDitherNames() {
+		d := Dither(name)
+		if d == DitherAtkinson {
+			// Atkinson drops 1/4 of the error so isn't balanced.
+			continue
+		}
+		res, err := ApplyDithered(gray(16, 16, 128), blackAndWhite, d)
+		if err != nil {
+			t.Fatalf("%s: ApplyDithered: %v", d, err)
+		}
+		if white := countIndex(res, 1); white < 112 || white > 144 {
+			t.Errorf("%s: %d/256 white pixels, want about 128", d, white)
+		}
+	}
+}
+
+func TestDitherDeterministic(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(8 * x), G: uint8(8 * y), B: uint8(4 * (x + y)), A: 255})
+		}
+	}
+	p, _ := Lookup("pico8")
+	for _, name := range AllDitherNames() {
+		a, _ := ApplyDithered(img, p, Dither(name))
+		b, _ := ApplyDithered(img, p, Dither(name))
+		if string(a.Pix) != string(b.Pix) {
+			t.Errorf("%s: not deterministic", name)
+		}
+	}
+}
+
+func TestValidateDither(t *testing.T) {
+	if err := ValidateDither(DitherNone); err != nil {
+		t.Errorf("ValidateDither(none): %v", err)
+	}
+	if err := ValidateDither("bogus"); err == nil {
+		t.Errorf("ValidateDither(bogus): expected error")
+	}
+}
@@ -0,0 +1,287 @@
+package palette
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// Method names a way to derive a palette from the colors of an image.
+type Method string
+
+const (
+	MethodMedianCut Method = "median_cut"
+	MethodOctree    Method = "octree"
+	MethodKMeans    Method = "kmeans"
+)
+
+var extractors = map[Method]func(counts []ColorCount, n int) color.Palette{
+	MethodMedianCut: medianCut,
+	MethodOctree:    octree,
+	MethodKMeans:    kMeans,
+}
+
+// AllMethodNames returns the sorted names of all the palette extraction methods.
+func AllMethodNames() []string {
+	var names []string
+	for m := range extractors {
+		names = append(names, string(m))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ColorCount is the number of pixels of a color in an image.
+type ColorCount struct {
+	Color color.RGBA
+	Count int
+}
+
+// SortedColorCounts flattens a histogram of colors, ordered by color so
+// extraction is deterministic.
+func SortedColorCounts(hist map[color.RGBA]int) []ColorCount {
+	var res []ColorCount
+	for c, n := range hist {
+		res = append(res, ColorCount{c, n})
+	}
+	sort.Slice(res, func(i, j int) bool { return packRGB(res[i].Color) < packRGB(res[j].Color) })
+	return res
+}
+
+func packRGB(c color.RGBA) uint32 {
+	return uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// Extract derives a palette of at most n colors from counts using method.
+func Extract(counts []ColorCount, n int, method Method) (color.Palette, error) {
+	if n < 1 || n > 256 {
+		return nil, errors.Errorf("invalid palette size %d, must be 1-256", n)
+	}
+	extract, ok := extractors[method]
+	if !ok {
+		return nil, errors.Errorf("invalid palette method: %s", method)
+	}
+	if len(counts) == 0 {
+		return nil, errors.Errorf("no colors to extract a palette from")
+	}
+	return extract(counts, n), nil
+}
+
+type rgbSum struct {
+	r, g, b float64
+	n       float64
+}
+
+func (s *rgbSum) add(c color.RGBA, count int) {
+	w := float64(count)
+	s.r += float64(c.R) * w
+	s.g += float64(c.G) * w
+	s.b += float64(c.B) * w
+	s.n += w
+}
+
+func (s *rgbSum) mean() color.RGBA {
+	if s.n == 0 {
+		return color.RGBA{A: 255}
+	}
+	round := func(v float64) uint8 { return uint8(math.Round(v / s.n)) }
+	return color.RGBA{R: round(s.r), G: round(s.g), B: round(s.b), A: 255}
+}
+
+func channel(c color.RGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// medianCut repeatedly splits the box of colors with the widest channel at
+// the pixel-weighted median of that channel.
+func medianCut(counts []ColorCount, n int) color.Palette {
+	type box struct {
+		colors []ColorCount
+	}
+	widest := func(b box) (ch int, width int) {
+		for c := 0; c < 3; c++ {
+			lo, hi := uint8(255), uint8(0)
+			for _, cc := range b.colors {
+				v := channel(cc.Color, c)
+				if v < lo {
+					lo = v
+				}
+				if v > hi {
+					hi = v
+				}
+			}
+			if w := int(hi) - int(lo); w > width {
+				ch, width = c, w
+			}
+		}
+		return
+	}
+
+	boxes := []box{{counts}}
+	for len(boxes) < n {
+		best, bestCh, bestWidth := -1, 0, 0
+		for i, b := range boxes {
+			if len(b.colors) < 2 {
+				continue
+			}
+			if ch, w := widest(b); w > bestWidth {
+				best, bestCh, bestWidth = i, ch, w
+			}
+		}
+		if best < 0 {
+			break
+		}
+		colors := append([]ColorCount{}, boxes[best].colors...)
+		sort.SliceStable(colors, func(i, j int) bool {
+			return channel(colors[i].Color, bestCh) < channel(colors[j].Color, bestCh)
+		})
+		var total, sum int
+		for _, cc := range colors {
+			total += cc.Count
+		}
+		split := 1
+		for i, cc := range colors[:len(colors)-1] {
+			sum += cc.Count
+			split = i + 1
+			if 2*sum >= total {
+				break
+			}
+		}
+		boxes[best] = box{colors[:split]}
+		boxes = append(boxes, box{colors[split:]})
+	}
+
+	var res color.Palette
+	for _, b := range boxes {
+		var s rgbSum
+		for _, cc := range b.colors {
+			s.add(cc.Color, cc.Count)
+		}
+		res = append(res, s.mean())
+	}
+	return res
+}
+
+type octreeNode struct {
+	children [8]*octreeNode
+	sum      rgbSum
+	leaf     bool
+}
+
+// octree buckets colors by successive bits of R, G and B and then merges the
+// deepest nodes into their parents until there are at most n leaves.
+func octree(counts []ColorCount, n int) color.Palette {
+	const depth = 8
+	root := &octreeNode{}
+	var levels [depth][]*octreeNode
+	leaves := 0
+	for _, cc := range counts {
+		node := root
+		for level := 0; level < depth; level++ {
+			shift := 7 - level
+			i := int(cc.Color.R>>shift&1)<<2 | int(cc.Color.G>>shift&1)<<1 | int(cc.Color.B>>shift&1)
+			if node.children[i] == nil {
+				child := &octreeNode{leaf: level == depth-1}
+				node.children[i] = child
+				if child.leaf {
+					leaves++
+				} else {
+					levels[level+1] = append(levels[level+1], child)
+				}
+			}
+			node = node.children[i]
+		}
+		node.sum.add(cc.Color, cc.Count)
+	}
+	levels[0] = []*octreeNode{root}
+
+	for level := depth - 1; level >= 0 && leaves > n; level-- {
+		nodes := levels[level]
+		// Merge the least used nodes first.
+		weight := func(node *octreeNode) float64 {
+			var w float64
+			for _, c := range node.children {
+				if c != nil {
+					w += c.sum.n
+				}
+			}
+			return w
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return weight(nodes[i]) < weight(nodes[j]) })
+		for _, node := range nodes {
+			if leaves <= n {
+				break
+			}
+			merged := 0
+			for i, c := range node.children {
+				if c == nil {
+					continue
+				}
+				node.sum.r += c.sum.r
+				node.sum.g += c.sum.g
+				node.sum.b += c.sum.b
+				node.sum.n += c.sum.n
+				node.children[i] = nil
+				merged++
+			}
+			node.leaf = true
+			leaves -= merged - 1
+		}
+	}
+
+	var res color.Palette
+	var collect func(node *octreeNode)
+	collect = func(node *octreeNode) {
+		if node.leaf {
+			res = append(res, node.sum.mean())
+			return
+		}
+		for _, c := range node.children {
+			if c != nil {
+				collect(c)
+			}
+		}
+	}
+	collect(root)
+	return res
+}
+
+// kMeans refines the median cut palette with Lloyd's algorithm, weighting
+// each color by its pixel count.
+func kMeans(counts []ColorCount, n int) color.Palette {
+	const maxIterations = 16
+	centers := medianCut(counts, n)
+	m := makeMatcher(centers, nil)
+	assignments := make([]int, len(counts))
+	for iter := 0; iter < maxIterations; iter++ {
+		changed := false
+		for i, cc := range counts {
+			if a := m.index(toRGB(cc.Color)); a != assignments[i] || iter == 0 {
+				assignments[i] = a
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+		sums := make([]rgbSum, len(centers))
+		for i, cc := range counts {
+			sums[assignments[i]].add(cc.Color, cc.Count)
+		}
+		for i := range centers {
+			if sums[i].n > 0 {
+				centers[i] = sums[i].mean()
+			}
+		}
+		m = makeMatcher(centers, nil)
+	}
+	return centers
+}
@@ -0,0 +1,66 @@
+package palette
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestExtractTwoClusters(t *testing.T) {
+	hist := map[color.RGBA]int{
+		{R: 250, G: 10, B: 10, A: 255}: 10,
+		{R: 240, G: 20, B: 10, A: 255}: 10,
+		{R: 10, G: 10, B: 250, A: 255}: 10,
+		{R: 10, G: 20, B: 240, A: 255}: 10,
+	}
+	for _, name := range AllMethodNames() {
+		p, err := Extract(SortedColorCounts(hist), 2, Method(name))
+		if err != nil {
+			t.Fatalf("%s: Extract: %v", name, err)
+		}
+		if len(p) != 2 {
+			t.Fatalf("%s: got %d colors, want 2", name, len(p))
+		}
+		var reds, blues int
+		for _, c := range p {
+			r, _, b, _ := c.RGBA()
+			if r>>8 > 200 && b>>8 < 50 {
+				reds++
+			}
+			if b>>8 > 200 && r>>8 < 50 {
+				blues++
+			}
+		}
+		if reds != 1 || blues != 1 {
+			t.Errorf("%s: got %v, want one red and one blue", name, p)
+		}
+	}
+}
+
+func TestExtractAtMostN(t *testing.T) {
+	hist := map[color.RGBA]int{}
+	for i := 0; i < 64; i++ {
+		hist[color.RGBA{R: uint8(4 * i), G: uint8(255 - 4*i), B: uint8(i), A: 255}] = i + 1
+	}
+	for _, name := range AllMethodNames() {
+		p, err := Extract(SortedColorCounts(hist), 5, Method(name))
+		if err != nil {
+			t.Fatalf("%s: Extract: %v", name, err)
+		}
+		if len(p) == 0 || len(p) > 5 {
+			t.Errorf("%s: got %d colors, want 1-5", name, len(p))
+		}
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	counts := []ColorCount{{color.RGBA{A: 255}, 1}}
+	if _, err := Extract(counts, 0, MethodMedianCut); err == nil {
+		t.Errorf("Extract: expected error for size 0")
+	}
+	if _, err := Extract(counts, 4, "bogus"); err == nil {
+		t.Errorf("Extract: expected error for bogus method")
+	}
+	if _, err := Extract(nil, 4, MethodMedianCut); err == nil {
+		t.Errorf("Extract: expected error for no colors")
+	}
+}
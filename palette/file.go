@@ -0,0 +1,199 @@
+package palette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Load reads a palette from a file, choosing the format by extension:
+//   - .gpl: GIMP palette
+//   - .act: Adobe color table
+//   - .pal: JASC (Paint Shop Pro) palette
+//   - .hex: one RRGGBB color per line, as exported by Lospec
+func Load(file string) (color.Palette, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Errorf("reading palette %s: %v", file, err)
+	}
+	var p color.Palette
+	switch ext := strings.ToLower(path.Ext(file)); ext {
+	case ".gpl":
+		p, err = ParseGPL(bytes.NewReader(b))
+	case ".act":
+		p, err = ParseACT(b)
+	case ".pal":
+		p, err = ParseJASC(bytes.NewReader(b))
+	case ".hex":
+		p, err = ParseHex(bytes.NewReader(b))
+	default:
+		return nil, errors.Errorf("unknown palette format for %s", file)
+	}
+	if err != nil {
+		return nil, errors.Errorf("parsing palette %s: %v", file, err)
+	}
+	if err := validate(p); err != nil {
+		return nil, errors.Errorf("invalid palette %s: %v", file, err)
+	}
+	return p, nil
+}
+
+func validate(p color.Palette) error {
+	if len(p) == 0 {
+		return errors.Errorf("no colors")
+	}
+	if len(p) > 256 {
+		return errors.Errorf("%d colors, at most 256 are allowed", len(p))
+	}
+	return nil
+}
+
+// ParseGPL parses a GIMP palette, e.g.
+//
+//	GIMP Palette
+//	Name: Example
+//	Columns: 4
+//	# comment
+//	255   0   0	Red
+func ParseGPL(r io.Reader) (color.Palette, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() || strings.TrimSpace(s.Text()) != "GIMP Palette" {
+		return nil, errors.Errorf("line 1: missing \"GIMP Palette\" header")
+	}
+	var res color.Palette
+	for line := 2; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if strings.HasSuffix(fields[0], ":") {
+			// Name: and Columns: headers
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, errors.Errorf("line %d: expected \"R G B [name]\", got %q", line, text)
+		}
+		c, err := parseRGB(fields[:3])
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", line, err)
+		}
+		res = append(res, c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ParseACT parses an Adobe color table: 256 RGB triples, optionally followed by
+// a big-endian 16-bit count of the colors used and a 16-bit transparent index.
+func ParseACT(b []byte) (color.Palette, error) {
+	n := 256
+	switch len(b) {
+	case 768:
+	case 772:
+		n = int(binary.BigEndian.Uint16(b[768:770]))
+		if n == 0 || n > 256 {
+			return nil, errors.Errorf("invalid color count %d", n)
+		}
+	default:
+		return nil, errors.Errorf("expected 768 or 772 bytes, got %d", len(b))
+	}
+	var res color.Palette
+	for i := 0; i < n; i++ {
+		res = append(res, color.RGBA{R: b[3*i], G: b[3*i+1], B: b[3*i+2], A: 255})
+	}
+	return res, nil
+}
+
+// ParseJASC parses a JASC (Paint Shop Pro) palette, e.g.
+//
+//	JASC-PAL
+//	0100
+//	2
+//	255 0 0
+//	0 0 255
+func ParseJASC(r io.Reader) (color.Palette, error) {
+	s := bufio.NewScanner(r)
+	if !s.Scan() || strings.TrimSpace(s.Text()) != "JASC-PAL" {
+		return nil, errors.Errorf("line 1: missing \"JASC-PAL\" header")
+	}
+	if !s.Scan() {
+		return nil, errors.Errorf("line 2: missing version")
+	}
+	if !s.Scan() {
+		return nil, errors.Errorf("line 3: missing color count")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s.Text()))
+	if err != nil || n <= 0 {
+		return nil, errors.Errorf("line 3: invalid color count %q", s.Text())
+	}
+	var res color.Palette
+	for line := 4; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, errors.Errorf("line %d: expected \"R G B\", got %q", line, text)
+		}
+		c, err := parseRGB(fields)
+		if err != nil {
+			return nil, errors.Errorf("line %d: %v", line, err)
+		}
+		res = append(res, c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) != n {
+		return nil, errors.Errorf("header says %d colors, found %d", n, len(res))
+	}
+	return res, nil
+}
+
+// ParseHex parses one RRGGBB color per line, with an optional leading '#'.
+func ParseHex(r io.Reader) (color.Palette, error) {
+	s := bufio.NewScanner(r)
+	var res color.Palette
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimPrefix(strings.TrimSpace(s.Text()), "#")
+		if text == "" {
+			continue
+		}
+		if len(text) != 6 {
+			return nil, errors.Errorf("line %d: expected RRGGBB, got %q", line, s.Text())
+		}
+		v, err := strconv.ParseUint(text, 16, 32)
+		if err != nil {
+			return nil, errors.Errorf("line %d: expected RRGGBB, got %q", line, s.Text())
+		}
+		res = append(res, fromHex(uint32(v))...)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func parseRGB(fields []string) (color.Color, error) {
+	var comps [3]uint8
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < 0 || v > 255 {
+			return nil, errors.Errorf("invalid color component %q, must be 0-255", f)
+		}
+		comps[i] = uint8(v)
+	}
+	return color.RGBA{R: comps[0], G: comps[1], B: comps[2], A: 255}, nil
+}
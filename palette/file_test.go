@@ -0,0 +1,112 @@
+package palette
+
+import (
+	"image/color"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func opaque(r, g, b uint8) color.Color { return color.RGBA{R: r, G: g, B: b, A: 255} }
+
+func checkPalette(t *testing.T, name string, got, want color.Palette) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: got %d colors, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s: color %d = %v, want %v", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseGPL(t *testing.T) {
+	in := "GIMP Palette\nName: Test\nColumns: 2\n# comment\n255   0   0\tRed\n  0   0 255\tBlue: dark\n"
+	got, err := ParseGPL(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseGPL: %v", err)
+	}
+	checkPalette(t, "ParseGPL", got, color.Palette{opaque(255, 0, 0), opaque(0, 0, 255)})
+}
+
+func TestParseACT(t *testing.T) {
+	b := make([]byte, 772)
+	copy(b, []byte{1, 2, 3, 4, 5, 6})
+	b[769] = 2
+	got, err := ParseACT(b)
+	if err != nil {
+		t.Fatalf("ParseACT: %v", err)
+	}
+	checkPalette(t, "ParseACT", got, color.Palette{opaque(1, 2, 3), opaque(4, 5, 6)})
+
+	got, err = ParseACT(b[:768])
+	if err != nil {
+		t.Fatalf("ParseACT: %v", err)
+	}
+	if len(got) != 256 {
+		t.Errorf("ParseACT: got %d colors, want 256", len(got))
+	}
+}
+
+func TestParseJASC(t *testing.T) {
+	in := "JASC-PAL\r\n0100\r\n2\r\n255 0 0\r\n0 0 255\r\n"
+	got, err := ParseJASC(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("ParseJASC: %v", err)
+	}
+	checkPalette(t, "ParseJASC", got, color.Palette{opaque(255, 0, 0), opaque(0, 0, 255)})
+}
+
+func TestParseHex(t *testing.T) {
+	got, err := ParseHex(strings.NewReader("ff0000\n#0000FF\n\n"))
+	if err != nil {
+		t.Fatalf("ParseHex: %v", err)
+	}
+	checkPalette(t, "ParseHex", got, color.Palette{opaque(255, 0, 0), opaque(0, 0, 255)})
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fn   func() error
+	}{
+		{"gpl header", func() error { _, err := ParseGPL(strings.NewReader("255 0 0\n")); return err }},
+		{"gpl component", func() error { _, err := ParseGPL(strings.NewReader("GIMP Palette\n256 0 0\n")); return err }},
+		{"gpl short", func() error { _, err := ParseGPL(strings.NewReader("GIMP Palette\n255 0\n")); return err }},
+		{"act size", func() error { _, err := ParseACT(make([]byte, 10)); return err }},
+		{"act count", func() error { _, err := ParseACT(make([]byte, 772)); return err }},
+		{"jasc count", func() error { _, err := ParseJASC(strings.NewReader("JASC-PAL\n0100\n3\n0 0 0\n")); return err }},
+		{"hex", func() error { _, err := ParseHex(strings.NewReader("fff\n")); return err }},
+		{"hex digits", func() error { _, err := ParseHex(strings.NewReader("gggggg\n")); return err }},
+	} {
+		if err := tc.fn(); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	f := path.Join(dir, "test.hex")
+	if err := os.WriteFile(f, []byte("000000\nffffff\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(f)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checkPalette(t, "Load", got, color.Palette{opaque(0, 0, 0), opaque(255, 255, 255)})
+
+	empty := path.Join(dir, "empty.hex")
+	if err := os.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(empty); err == nil {
+		t.Errorf("Load: expected error for empty palette")
+	}
+	if _, err := Load(path.Join(dir, "test.txt")); err == nil {
+		t.Errorf("Load: expected error for unknown format")
+	}
+}
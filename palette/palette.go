@@ -0,0 +1,106 @@
+// Package palette defines named palettes of retro hardware and maps images onto them.
+package palette
+
+import (
+	"image"
+	"image/color"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	globalReg = makePaletteRegistry()
+)
+
+// Palette is a named, fixed set of colors.
+type Palette struct {
+	Name        string
+	Description string
+	Colors      color.Palette
+}
+
+type palReg struct {
+	reg map[string]Palette
+}
+
+func makePaletteRegistry() *palReg {
+	return &palReg{
+		reg: map[string]Palette{},
+	}
+}
+
+func (r *palReg) Register(p Palette) {
+	r.reg[p.Name] = p
+}
+
+func (r *palReg) Get(name string) (Palette, bool) {
+	p, ok := r.reg[name]
+	return p, ok
+}
+
+func (r *palReg) AllPaletteNames() []string {
+	var names []string
+	for n := range r.reg {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AllPaletteNames returns the sorted names of all the registered palettes.
+func AllPaletteNames() []string {
+	return globalReg.AllPaletteNames()
+}
+
+// Get returns the palette registered under name.
+func Get(name string) (Palette, bool) {
+	return globalReg.Get(name)
+}
+
+// Lookup returns the colors of the palette registered under name or an error if there is none.
+func Lookup(name string) (color.Palette, error) {
+	p, ok := globalReg.Get(name)
+	if !ok {
+		return nil, errors.Errorf("invalid palette: %s", name)
+	}
+	return p.Colors, nil
+}
+
+// Space maps 8-bit sRGB components, which may be out of the 0-255 range, to
+// coordinates in which the nearest palette color is the closest by Euclidean
+// distance. A nil Space matches in sRGB.
+type Space func(r, g, b float64) (x, y, z float64)
+
+// Apply maps every pixel of img to the nearest color in p.
+func Apply(img image.Image, p color.Palette) *image.Paletted {
+	return ApplyIn(img, p, nil)
+}
+
+// ApplyIn is Apply matching colors in space.
+func ApplyIn(img image.Image, p color.Palette, space Space) *image.Paletted {
+	bounds := img.Bounds()
+	res := image.NewPaletted(bounds, p)
+	var m *matcher
+	if space != nil {
+		m = makeMatcher(p, space)
+	}
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if m == nil {
+				res.SetColorIndex(x, y, uint8(p.Index(img.At(x, y))))
+			} else {
+				res.SetColorIndex(x, y, uint8(m.index(toRGB(img.At(x, y)))))
+			}
+		}
+	}
+	return res
+}
+
+func fromHex(hexes ...uint32) color.Palette {
+	var res color.Palette
+	for _, h := range hexes {
+		res = append(res, color.RGBA{R: uint8(h >> 16), G: uint8(h >> 8), B: uint8(h), A: 255})
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package palette
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestAllPalettesFitInPalettedImage(t *testing.T) {
+	for _, name := range AllPaletteNames() {
+		p, _ := Get(name)
+		if n := len(p.Colors); n == 0 || n > 256 {
+			t.Errorf("palette %s has %d colors, want 1-256", name, n)
+		}
+	}
+}
+
+func TestApplyKeepsPaletteColors(t *testing.T) {
+	p, err := Lookup("pico8")
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, len(p), 1))
+	for x, c := range p {
+		img.Set(x, 0, c)
+	}
+	res := Apply(img, p)
+	for x := range p {
+		if got, want := int(res.ColorIndexAt(x, 0)), x; got != want {
+			t.Errorf("Apply: index at %d = %d, want %d", x, got, want)
+		}
+	}
+}
+
+func TestApplyNearest(t *testing.T) {
+	p, _ := Lookup("gameboy_dmg")
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.RGBA{R: 0x10, G: 0x30, B: 0x10, A: 255})
+	if got, want := Apply(img, p).ColorIndexAt(0, 0), uint8(0); got != want {
+		t.Errorf("Apply: got index %d, want %d", got, want)
+	}
+}
+
+func TestLookupInvalid(t *testing.T) {
+	if _, err := Lookup("not-a-palette"); err == nil {
+		t.Errorf("Lookup: expected error")
+	}
+}
+
+func TestApplyInSpace(t *testing.T) {
+	p := color.Palette{color.RGBA{0, 0, 0, 255}, color.RGBA{255, 255, 255, 255}}
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Set(0, 0, color.RGBA{100, 100, 100, 255})
+
+	// Nearer black in sRGB, but nearer white in a space that takes square roots.
+	if got := Apply(img, p).ColorIndexAt(0, 0); got != 0 {
+		t.Errorf("Apply index = %d, want 0", got)
+	}
+	sqrt := func(r, g, b float64) (float64, float64, float64) { return math.Sqrt(r), math.Sqrt(g), math.Sqrt(b) }
+	if got := ApplyIn(img, p, sqrt).ColorIndexAt(0, 0); got != 1 {
+		t.Errorf("ApplyIn index = %d, want 1", got)
+	}
+}
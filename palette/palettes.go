@@ -0,0 +1,126 @@
+package palette
+
+import "image/color"
+
+// The colors of these palettes are ordered as the hardware numbers them, so
+// e.g. index 0x21 of the NES palette is NES color $21.
+
+var nes = fromHex(
+	0x7C7C7C, 0x0000FC, 0x0000BC, 0x4428BC, 0x940084, 0xA80020, 0xA81000, 0x881400,
+	0x503000, 0x007800, 0x006800, 0x005800, 0x004058, 0x000000, 0x000000, 0x000000,
+	0xBCBCBC, 0x0078F8, 0x0058F8, 0x6844FC, 0xD800CC, 0xE40058, 0xF83800, 0xE45C10,
+	0xAC7C00, 0x00B800, 0x00A800, 0x00A844, 0x008888, 0x000000, 0x000000, 0x000000,
+	0xF8F8F8, 0x3CBCFC, 0x6888FC, 0x9878F8, 0xF878F8, 0xF85898, 0xF87858, 0xFCA044,
+	0xF8B800, 0xB8F818, 0x58D854, 0x58F898, 0x00E8D8, 0x787878, 0x000000, 0x000000,
+	0xFCFCFC, 0xA4E4FC, 0xB8B8F8, 0xD8B8F8, 0xF8B8F8, 0xF8A4C0, 0xF0D0B0, 0xFCE0A8,
+	0xF8D878, 0xD8F878, 0xB8F8B8, 0xB8F8D8, 0x00FCFC, 0xF8D8F8, 0x000000, 0x000000,
+)
+
+// Darkest to lightest.
+var gameboyDMG = fromHex(0x0F380F, 0x306230, 0x8BAC0F, 0x9BBC0F)
+
+var cga = fromHex(
+	0x000000, 0x0000AA, 0x00AA00, 0x00AAAA, 0xAA0000, 0xAA00AA, 0xAA5500, 0xAAAAAA,
+	0x555555, 0x5555FF, 0x55FF55, 0x55FFFF, 0xFF5555, 0xFF55FF, 0xFFFF55, 0xFFFFFF,
+)
+
+// Pepto's measurements of the VIC-II.
+var c64 = fromHex(
+	0x000000, 0xFFFFFF, 0x68372B, 0x70A4B2, 0x6F3D86, 0x588D43, 0x352879, 0xB8C76F,
+	0x6F4F25, 0x433900, 0x9A6759, 0x444444, 0x6C6C6C, 0x9AD284, 0x6C5EB5, 0x959595,
+)
+
+// The 8 normal colors followed by the BRIGHT variants of blue through white;
+// bright black is the same as black.
+var zxSpectrum = fromHex(
+	0x000000, 0x0000D7, 0xD70000, 0xD700D7, 0x00D700, 0x00D7D7, 0xD7D700, 0xD7D7D7,
+	0x0000FF, 0xFF0000, 0xFF00FF, 0x00FF00, 0x00FFFF, 0xFFFF00, 0xFFFFFF,
+)
+
+var pico8 = fromHex(
+	0x000000, 0x1D2B53, 0x7E2553, 0x008751, 0xAB5236, 0x5F574F, 0xC2C3C7, 0xFFF1E8,
+	0xFF004D, 0xFFA300, 0xFFEC27, 0x00E436, 0x29ADFF, 0x83769C, 0xFF77A8, 0xFFCCAA,
+)
+
+// 16 hues by 8 luminances.
+var atari2600NTSC = fromHex(
+	0x000000, 0x404040, 0x6C6C6C, 0x909090, 0xB0B0B0, 0xC8C8C8, 0xDCDCDC, 0xECECEC,
+	0x444400, 0x646410, 0x848424, 0xA0A034, 0xB8B840, 0xD0D050, 0xE8E85C, 0xFCFC68,
+	0x702800, 0x844414, 0x985C28, 0xAC783C, 0xBC8C4C, 0xCCA05C, 0xDCB468, 0xECC878,
+	0x841800, 0x983418, 0xAC5030, 0xC06848, 0xD0805C, 0xE09470, 0xECA880, 0xFCBC94,
+	0x880000, 0x9C2020, 0xB03C3C, 0xC05858, 0xD07070, 0xE08888, 0xECA0A0, 0xFCB4B4,
+	0x78005C, 0x8C2074, 0xA03C88, 0xB0589C, 0xC070B0, 0xD084C0, 0xDC9CD0, 0xECB0E0,
+	0x480078, 0x602090, 0x783CA4, 0x8C58B8, 0xA070CC, 0xB484DC, 0xC49CEC, 0xD4B0FC,
+	0x140084, 0x302098, 0x4C3CAC, 0x6858C0, 0x7C70D0, 0x9488E0, 0xA8A0EC, 0xBCB4FC,
+	0x000088, 0x1C209C, 0x3840B0, 0x505CC0, 0x6874D0, 0x7C8CE0, 0x90A4EC, 0xA4B8FC,
+	0x00187C, 0x1C3890, 0x3854A8, 0x5070BC, 0x6888CC, 0x7C9CDC, 0x90B4EC, 0xA4C8FC,
+	0x002C5C, 0x1C4C78, 0x386890, 0x5084AC, 0x689CC0, 0x7CB4D4, 0x90CCE8, 0xA4E0FC,
+	0x003C2C, 0x1C5C48, 0x387C64, 0x509C80, 0x68B494, 0x7CD0AC, 0x90E4C0, 0xA4FCD4,
+	0x003C00, 0x205C20, 0x407C40, 0x5C9C5C, 0x74B474, 0x8CD08C, 0xA4E4A4, 0xB8FCB8,
+	0x143800, 0x345C1C, 0x507C38, 0x6C9850, 0x84B468, 0x9CCC7C, 0xB4E490, 0xC8FCA4,
+	0x2C3000, 0x4C501C, 0x687034, 0x848C4C, 0x9CA864, 0xB4C078, 0xCCD488, 0xE0EC9C,
+	0x442800, 0x644818, 0x846830, 0xA08444, 0xB89C58, 0xD0B46C, 0xE8CC7C, 0xFCE08C,
+)
+
+// The 16 HTML 4 colors plus a 3x3x3 grid of darker tones.
+var html = fromHex(
+	0xFFFFFF, 0xC0C0C0, 0x808080, 0x000000, 0xFF0000, 0x800000, 0xFFFF00, 0x808000,
+	0x00FF00, 0x008000, 0x00FFFF, 0x008080, 0x0000FF, 0x000080, 0xFF00FF, 0x800080,
+	0x202020, 0x202060, 0x2020A0, 0x206020, 0x206060, 0x2060A0, 0x20A020, 0x20A060,
+	0x20A0A0, 0x602020, 0x602060, 0x6020A0, 0x606020, 0x606060, 0x6060A0, 0x60A020,
+	0x60A060, 0x60A0A0, 0xA02020, 0xA02060, 0xA020A0, 0xA06020, 0xA06060, 0xA060A0,
+	0xA0A020, 0xA0A060, 0xA0A0A0,
+)
+
+// cgaMode4 returns the 4 colors of CGA 320x200 graphics mode: black as the
+// background plus 3 colors picked from the 16 CGA colors.
+func cgaMode4(c1, c2, c3 int) color.Palette {
+	return color.Palette{cga[0], cga[c1], cga[c2], cga[c3]}
+}
+
+// ega returns the 64 colors of the EGA, where each index is the 6-bit value rgbRGB.
+func ega() color.Palette {
+	var res color.Palette
+	for i := 0; i < 64; i++ {
+		comp := func(hi, lo uint) uint8 {
+			return uint8(0xAA*((i>>hi)&1) + 0x55*((i>>lo)&1))
+		}
+		res = append(res, color.RGBA{R: comp(2, 5), G: comp(1, 4), B: comp(0, 3), A: 255})
+	}
+	return res
+}
+
+func webSafe() color.Palette {
+	var res color.Palette
+	for r := 0; r < 6; r++ {
+		for g := 0; g < 6; g++ {
+			for b := 0; b < 6; b++ {
+				res = append(res, color.RGBA{R: uint8(r * 0x33), G: uint8(g * 0x33), B: uint8(b * 0x33), A: 255})
+			}
+		}
+	}
+	return res
+}
+
+func init() {
+	for _, p := range []Palette{
+		{"nes", "NES 2C02 PPU, 64 entries indexed by NES color number", nes},
+		{"gameboy_dmg", "Game Boy (DMG) 4-shade green", gameboyDMG},
+		{"cga", "CGA 16-color RGBI", cga},
+		{"cga_mode4_p0_low", "CGA mode 4, palette 0, low intensity (green, red, brown)", cgaMode4(2, 4, 6)},
+		{"cga_mode4_p0_high", "CGA mode 4, palette 0, high intensity (light green, light red, yellow)", cgaMode4(10, 12, 14)},
+		{"cga_mode4_p1_low", "CGA mode 4, palette 1, low intensity (cyan, magenta, light gray)", cgaMode4(3, 5, 7)},
+		{"cga_mode4_p1_high", "CGA mode 4, palette 1, high intensity (light cyan, light magenta, white)", cgaMode4(11, 13, 15)},
+		{"cga_mode5_low", "CGA mode 5, low intensity (cyan, red, light gray)", cgaMode4(3, 4, 7)},
+		{"cga_mode5_high", "CGA mode 5, high intensity (light cyan, light red, white)", cgaMode4(11, 12, 15)},
+		{"ega", "EGA 64-color", ega()},
+		{"c64", "Commodore 64 VIC-II (Pepto)", c64},
+		{"zx_spectrum", "ZX Spectrum 15-color, normal then BRIGHT", zxSpectrum},
+		{"pico8", "PICO-8 16-color", pico8},
+		{"atari2600_ntsc", "Atari 2600 NTSC 128-color", atari2600NTSC},
+		{"websafe", "Web-safe 216-color", webSafe()},
+		{"html", "HTML 4 16-color plus 27 darker tones; used by websafe_pixelated", html},
+	} {
+		globalReg.Register(p)
+	}
+}
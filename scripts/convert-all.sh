@@ -1,7 +1,3 @@
 #!/bin/sh
 
-for f in data/in/*; do
-    out=data/out/$(basename $f)
-    echo "Convert $f -> $out"
-    go run main.go --input "$f" --output "$out"
-done
\ No newline at end of file
+go run main.go --input data/in --output_dir data/out "$@"